@@ -1,35 +1,50 @@
 package main
 
 import (
-    "log"
+	"log"
 
-    "github.com/joho/godotenv"
-    "github.com/temu-in/temu.in/booking-system-backend/internal/config"
-    "gorm.io/driver/postgres"
-    "gorm.io/gorm"
-    "github.com/temu-in/temu.in/booking-system-backend/internal/models"
-    "github.com/temu-in/temu.in/booking-system-backend/internal/seeder"
+	"github.com/joho/godotenv"
+	"github.com/temu-in/temu.in/booking-system-backend/internal/audit"
+	"github.com/temu-in/temu.in/booking-system-backend/internal/config"
+	"github.com/temu-in/temu.in/booking-system-backend/internal/models"
+	"github.com/temu-in/temu.in/booking-system-backend/internal/password"
+	"github.com/temu-in/temu.in/booking-system-backend/internal/seeder"
+	"github.com/temu-in/temu.in/booking-system-backend/internal/user"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
 )
 
 func main() {
-    _ = godotenv.Load()
-    cfg, err := config.Load()
-    if err != nil {
-        log.Fatalf("load config: %v", err)
-    }
+	_ = godotenv.Load()
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("load config: %v", err)
+	}
 
-    db, err := gorm.Open(postgres.Open(cfg.DatabaseURL), &gorm.Config{})
-    if err != nil {
-        log.Fatalf("connect db: %v", err)
-    }
+	db, err := gorm.Open(postgres.Open(cfg.DatabaseURL), &gorm.Config{})
+	if err != nil {
+		log.Fatalf("connect db: %v", err)
+	}
 
-    if err := db.AutoMigrate(&models.User{}); err != nil {
-        log.Fatalf("migrate: %v", err)
-    }
+	if err := user.MigrateVerification(db); err != nil {
+		log.Fatalf("migrate email verification: %v", err)
+	}
+	if err := db.AutoMigrate(&models.User{}, &models.RefreshToken{}, &models.AdminAudit{}, &models.AuditChainHead{}, &models.ActionToken{}, &models.SecurityEvent{}, &models.RecoveryCode{}, &models.APIKey{}, &models.Passkey{}, &models.Identity{}); err != nil {
+		log.Fatalf("migrate: %v", err)
+	}
+	if err := user.MigrateRoles(db); err != nil {
+		log.Fatalf("migrate roles: %v", err)
+	}
+	if err := user.MigrateSearchIndexes(db); err != nil {
+		log.Printf("user search indexes: %v", err)
+	}
+	if err := audit.Migrate(db); err != nil {
+		log.Fatalf("migrate audit log: %v", err)
+	}
 
-    if err := seeder.SeedAdmin(db); err != nil {
-        log.Fatalf("seed admin: %v", err)
-    }
+	if err := seeder.SeedAdmin(db, password.FromConfig(cfg)); err != nil {
+		log.Fatalf("seed admin: %v", err)
+	}
 
-    log.Println("migrations applied and admin seeding attempted")
+	log.Println("migrations applied and admin seeding attempted")
 }
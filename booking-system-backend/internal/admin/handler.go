@@ -1,80 +1,722 @@
 package admin
 
 import (
-    "net/http"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
-    "github.com/gin-gonic/gin"
-    auth "github.com/temu-in/temu.in/booking-system-backend/internal/auth"
-    "github.com/temu-in/temu.in/booking-system-backend/internal/user"
-    "github.com/temu-in/temu.in/booking-system-backend/internal/audit"
-    "github.com/temu-in/temu.in/booking-system-backend/internal/models"
+	"github.com/gin-gonic/gin"
+	"github.com/temu-in/temu.in/booking-system-backend/internal/audit"
+	auth "github.com/temu-in/temu.in/booking-system-backend/internal/auth"
+	"github.com/temu-in/temu.in/booking-system-backend/internal/models"
+	"github.com/temu-in/temu.in/booking-system-backend/internal/pagination"
+	"github.com/temu-in/temu.in/booking-system-backend/internal/token"
+	"github.com/temu-in/temu.in/booking-system-backend/internal/user"
 )
 
 type Handler struct {
-    repo  *user.Repository
-    audit *audit.Repository
+	repo     *user.Repository
+	audit    *audit.Repository
+	tokens   *token.Repository
+	denylist *auth.Denylist
+	limiter  *auth.LoginLimiter
+	authz    *auth.Authorizer
+	imp      *auth.Impersonator
 }
 
-func NewHandler(repo *user.Repository, auditRepo *audit.Repository) *Handler {
-    return &Handler{repo: repo, audit: auditRepo}
+func NewHandler(repo *user.Repository, auditRepo *audit.Repository, tokens *token.Repository, denylist *auth.Denylist, limiter *auth.LoginLimiter, authz *auth.Authorizer, imp *auth.Impersonator) *Handler {
+	return &Handler{repo: repo, audit: auditRepo, tokens: tokens, denylist: denylist, limiter: limiter, authz: authz, imp: imp}
 }
 
-func (h *Handler) RegisterRoutes(rg *gin.RouterGroup, secret string) {
-    grp := rg.Group("/admin")
-    grp.Use(auth.Middleware(secret), auth.RequireRole("admin"))
-    grp.POST("/promote", h.Promote)
-    grp.GET("/users", h.ListUsers)
-    grp.GET("/audit", h.ListAudit)
+// RegisterRoutes mounts the admin API; requireAuth is the shared auth.Middleware
+// and extra runs after the staff check (e.g. auth.RequireMFA). Each route then
+// needs its own permission.
+func (h *Handler) RegisterRoutes(rg *gin.RouterGroup, requireAuth gin.HandlerFunc, extra ...gin.HandlerFunc) {
+	grp := rg.Group("/admin")
+	grp.Use(requireAuth, h.authz.RequireStaff())
+	grp.Use(extra...)
+	perm := h.authz.RequirePermission
+
+	// API keys additionally need the matching admin scope
+	users := grp.Group("", auth.RequireScope(auth.ScopeAdminUsers))
+	users.POST("/promote", auth.RequireSession(), perm(auth.PermUsersRoles), h.Promote)
+	users.GET("/users", perm(auth.PermUsersRead), h.ListUsers)
+	users.PUT("/users/:id/role", auth.RequireSession(), perm(auth.PermUsersRoles), h.ChangeRole)
+	users.POST("/users/:id/suspend", auth.RequireSession(), perm(auth.PermUsersManage), h.SuspendUser)
+	users.POST("/users/:id/unsuspend", auth.RequireSession(), perm(auth.PermUsersManage), h.UnsuspendUser)
+	users.DELETE("/users/:id", auth.RequireSession(), perm(auth.PermUsersManage), h.DeleteUser)
+	users.POST("/users/:id/restore", auth.RequireSession(), perm(auth.PermUsersManage), h.RestoreUser)
+	users.POST("/users/:id/verify", perm(auth.PermUsersManage), h.VerifyUser)
+	users.POST("/users/:id/unlock", perm(auth.PermUsersManage), h.UnlockUser)
+	users.GET("/users/:id/sessions", perm(auth.PermUsersRead), h.ListUserSessions)
+	users.DELETE("/users/:id/sessions/:sid", perm(auth.PermUsersManage), h.RevokeUserSession)
+	users.POST("/users/:id/logout", perm(auth.PermUsersManage), h.ForceLogout)
+	users.POST("/users/:id/impersonate", auth.RequireSession(), perm(auth.PermUsersImpersonate), h.Impersonate)
+
+	audit := grp.Group("", auth.RequireScope(auth.ScopeAdminAudit), perm(auth.PermAuditRead))
+	audit.GET("/audit", h.ListAudit)
+	audit.GET("/audit/export", h.ExportAudit)
+	audit.GET("/audit/verify", h.VerifyAudit)
+	audit.GET("/security-events", h.ListSecurityEvents)
 }
 
+// ListUsers pages through users. Filters: role, verified, created_after and
+// created_before (RFC 3339 or YYYY-MM-DD; before is exclusive) and q, a
+// substring of the email or name. Sort with e.g. ?sort=-created_at.
 func (h *Handler) ListUsers(c *gin.Context) {
-    users, err := h.repo.ListAll()
-    if err != nil {
-        c.JSON(http.StatusInternalServerError, gin.H{"error": "failed"})
-        return
-    }
-    c.JSON(http.StatusOK, gin.H{"users": users})
+	p, err := pagination.FromQuery(c, user.UserSorts, "-created_at")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	f := user.ListFilter{Query: strings.TrimSpace(c.Query("q"))}
+	if s := c.Query("role"); s != "" {
+		if f.Role, err = models.ParseRole(s); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	if s := c.Query("verified"); s != "" {
+		v, err := strconv.ParseBool(s)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "verified must be true or false"})
+			return
+		}
+		f.Verified = &v
+	}
+	if f.CreatedAfter, err = timeParam(c, "created_after"); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if f.CreatedBefore, err = timeParam(c, "created_before"); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	users, total, err := h.repo.List(f, p)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed"})
+		return
+	}
+	c.JSON(http.StatusOK, pagination.NewPage(users, total, p))
 }
 
+// ListAudit pages through the audit log, newest first, with ?cursor and
+// ?limit. Filters: actor_id, action, target_prefix (e.g. "user:"),
+// created_after and created_before.
 func (h *Handler) ListAudit(c *gin.Context) {
-    audits, err := h.audit.ListAll()
-    if err != nil {
-        c.JSON(http.StatusInternalServerError, gin.H{"error": "failed"})
-        return
-    }
-    c.JSON(http.StatusOK, gin.H{"audit": audits})
+	f, ok := auditFilter(c)
+	if !ok {
+		return
+	}
+	p, err := pagination.CursorFromQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	audits, err := h.audit.List(f, p)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed"})
+		return
+	}
+	c.JSON(http.StatusOK, pagination.NewCursorPage(audits, p, audit.AuditCursor))
+}
+
+// exportFlushEvery is how many rows an export writes between flushes.
+const exportFlushEvery = 500
+
+// ExportAudit streams the audit log entries matching the ListAudit filters,
+// oldest first, as ?format=csv (the default) or ndjson. Rows go out as they
+// are read, so the export has no size limit. The export itself is audited.
+// Cells are written verbatim so every row can be checked against its hash
+// (see audit.Hash); details are free text, so open the CSV in a spreadsheet
+// as text rather than letting it evaluate formulas.
+func (h *Handler) ExportAudit(c *gin.Context) {
+	f, ok := auditFilter(c)
+	if !ok {
+		return
+	}
+	format := c.DefaultQuery("format", "csv")
+	var contentType string
+	switch format {
+	case "csv":
+		contentType = "text/csv; charset=utf-8"
+	case "ndjson":
+		contentType = "application/x-ndjson"
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be csv or ndjson"})
+		return
+	}
+	_ = h.audit.Create(&models.AdminAudit{ActorID: actorID(c), Action: "export_audit", Target: "audit", Details: "format " + format + "; " + c.Request.URL.RawQuery})
+
+	filename := "audit-" + time.Now().UTC().Format("20060102T150405Z") + "." + format
+	c.Header("Content-Type", contentType)
+	c.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+	c.Header("Cache-Control", "no-store")
+	c.Status(http.StatusOK)
+
+	var write func(*models.AdminAudit) error
+	var flush func() error
+	if format == "csv" {
+		w := csv.NewWriter(c.Writer)
+		_ = w.Write([]string{"id", "created_at", "actor_id", "action", "target", "details", "prev_hash", "hash"})
+		write = func(a *models.AdminAudit) error {
+			return w.Write([]string{
+				strconv.FormatUint(uint64(a.ID), 10), a.CreatedAt.UTC().Format(time.RFC3339Nano), strconv.FormatUint(uint64(a.ActorID), 10),
+				a.Action, a.Target, a.Details, a.PrevHash, a.Hash,
+			})
+		}
+		flush = func() error { w.Flush(); return w.Error() }
+	} else {
+		enc := json.NewEncoder(c.Writer)
+		write = func(a *models.AdminAudit) error { return enc.Encode(a) }
+		flush = func() error { return nil }
+	}
+
+	n := 0
+	err := h.audit.Stream(c.Request.Context(), f, func(a *models.AdminAudit) error {
+		if err := write(a); err != nil {
+			return err
+		}
+		if n++; n%exportFlushEvery == 0 {
+			if err := flush(); err != nil {
+				return err
+			}
+			c.Writer.Flush()
+		}
+		return nil
+	})
+	if err == nil {
+		err = flush()
+	}
+	if err != nil {
+		// the status is long sent; a truncated file is all we can signal
+		log.Printf("audit export after %d rows: %v", n, err)
+		return
+	}
+	c.Writer.Flush()
+}
+
+// VerifyAudit walks the audit log's hash chain and reports the first broken
+// link, if any.
+func (h *Handler) VerifyAudit(c *gin.Context) {
+	res, err := h.audit.Verify(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed"})
+		return
+	}
+	c.JSON(http.StatusOK, res)
+}
+
+// auditFilter reads the audit log filters from the query string, writing the
+// error response itself when they are invalid.
+func auditFilter(c *gin.Context) (audit.Filter, bool) {
+	f := audit.Filter{Action: c.Query("action"), TargetPrefix: c.Query("target_prefix")}
+	if s := c.Query("actor_id"); s != "" {
+		id, err := strconv.ParseUint(s, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid actor_id"})
+			return f, false
+		}
+		f.ActorID = uint(id)
+	}
+	var err error
+	if f.CreatedAfter, err = timeParam(c, "created_after"); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return f, false
+	}
+	if f.CreatedBefore, err = timeParam(c, "created_before"); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return f, false
+	}
+	return f, true
 }
 
 type promoteReq struct {
-    Email string `json:"email" binding:"required,email"`
+	Email string `json:"email" binding:"required,email"`
 }
 
 func (h *Handler) Promote(c *gin.Context) {
-    var req promoteReq
-    if err := c.ShouldBindJSON(&req); err != nil {
-        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-        return
-    }
-
-    u, err := h.repo.FindByEmail(req.Email)
-    if err != nil || u == nil {
-        c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
-        return
-    }
-
-    if err := h.repo.SetRole(u.ID, "admin"); err != nil {
-        c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to promote"})
-        return
-    }
-
-    // record audit (actor from JWT claims if present)
-    actorID := uint(0)
-    if v, ok := c.Get(auth.UserContextKey); ok {
-        if claims, ok := v.(*auth.Claims); ok {
-            actorID = claims.UserID
-        }
-    }
-    _ = h.audit.Create(&models.AdminAudit{ActorID: actorID, Action: "promote_user", Target: "user:" + u.Email, Details: "promoted to admin"})
-
-    c.JSON(http.StatusOK, gin.H{"status": "promoted"})
+	var req promoteReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	u, err := h.repo.FindByEmail(req.Email)
+	if err != nil || u == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+		return
+	}
+
+	// same rule as ChangeRole: only admins hand out staff roles
+	v, _ := c.Get(auth.UserContextKey)
+	if actor, _ := v.(*auth.Claims); actor == nil || actor.Role != models.RoleAdmin {
+		c.JSON(http.StatusForbidden, gin.H{"error": "only admins can change staff roles"})
+		return
+	}
+
+	old, err := h.repo.ChangeRole(u.ID, models.RoleAdmin)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to promote"})
+		return
+	}
+	if old == models.RoleAdmin {
+		c.JSON(http.StatusOK, gin.H{"status": "unchanged", "role": old})
+		return
+	}
+
+	// ChangeRole bumped the security version, which retires the old tokens
+	_ = h.audit.Create(&models.AdminAudit{ActorID: actorID(c), Action: "promote_user", Target: "user:" + u.Email, Details: "role " + string(old) + " -> admin"})
+
+	c.JSON(http.StatusOK, gin.H{"status": "promoted"})
+}
+
+type changeRoleReq struct {
+	Role   models.Role `json:"role" binding:"required"`
+	Reason string      `json:"reason" binding:"required,max=500"`
+}
+
+// ChangeRole moves a user to another role. Only admins may grant or take away
+// a staff role, and the last admin cannot be demoted.
+func (h *Handler) ChangeRole(c *gin.Context) {
+	var req changeRoleReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	u, ok := h.userParam(c)
+	if !ok {
+		return
+	}
+	actor, ok := targetAllowed(c, u)
+	if !ok {
+		return
+	}
+	if req.Role.IsStaff() && actor.Role != models.RoleAdmin {
+		c.JSON(http.StatusForbidden, gin.H{"error": "only admins can change staff roles"})
+		return
+	}
+
+	old, err := h.repo.ChangeRole(u.ID, req.Role)
+	if err != nil {
+		if errors.Is(err, user.ErrLastAdmin) {
+			c.JSON(http.StatusConflict, gin.H{"error": "cannot demote the last admin"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to change role"})
+		return
+	}
+	if old == req.Role {
+		c.JSON(http.StatusOK, gin.H{"status": "unchanged", "role": old})
+		return
+	}
+
+	_ = h.audit.Create(&models.AdminAudit{ActorID: actor.UserID, Action: "change_role", Target: "user:" + u.Email, Details: "role " + string(old) + " -> " + string(req.Role) + "; reason: " + req.Reason})
+
+	c.JSON(http.StatusOK, gin.H{"status": "role_changed", "old_role": old, "role": req.Role})
+}
+
+type suspendReq struct {
+	Reason string `json:"reason" binding:"required,max=500"`
+	// Until ends the suspension on its own; omit it to suspend indefinitely.
+	Until *time.Time `json:"until"`
+}
+
+// SuspendUser blocks a user from logging in and ends all their sessions and
+// API keys. Tokens already issued stop working through the security version.
+func (h *Handler) SuspendUser(c *gin.Context) {
+	var req suspendReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Until != nil && !req.Until.After(time.Now()) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "until must be in the future"})
+		return
+	}
+	u, ok := h.userParam(c)
+	if !ok {
+		return
+	}
+	actor, ok := targetAllowed(c, u)
+	if !ok {
+		return
+	}
+
+	if err := h.repo.Suspend(u.ID, req.Reason, req.Until); err != nil {
+		if errors.Is(err, user.ErrLastAdmin) {
+			c.JSON(http.StatusConflict, gin.H{"error": "cannot suspend the last admin"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to suspend"})
+		return
+	}
+	if !h.revokeAccess(c, u.ID) {
+		return
+	}
+	details := "reason: " + req.Reason
+	if req.Until != nil {
+		details += "; until " + req.Until.UTC().Format(time.RFC3339)
+	}
+	_ = h.audit.Create(&models.AdminAudit{ActorID: actor.UserID, Action: "suspend_user", Target: "user:" + u.Email, Details: details})
+
+	c.JSON(http.StatusOK, gin.H{"status": "suspended"})
+}
+
+type reasonReq struct {
+	Reason string `json:"reason" binding:"required,max=500"`
+}
+
+func (h *Handler) UnsuspendUser(c *gin.Context) {
+	var req reasonReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	u, ok := h.userParam(c)
+	if !ok {
+		return
+	}
+	actor, ok := targetAllowed(c, u)
+	if !ok {
+		return
+	}
+	if u.SuspendedAt == nil {
+		c.JSON(http.StatusOK, gin.H{"status": "not_suspended"})
+		return
+	}
+
+	if err := h.repo.Unsuspend(u.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to unsuspend"})
+		return
+	}
+	_ = h.audit.Create(&models.AdminAudit{ActorID: actor.UserID, Action: "unsuspend_user", Target: "user:" + u.Email, Details: "reason: " + req.Reason})
+
+	c.JSON(http.StatusOK, gin.H{"status": "unsuspended"})
+}
+
+// DeleteUser soft-deletes a user: the account disappears from lookups and
+// listings and its sessions and API keys are revoked, but RestoreUser can
+// bring it back.
+func (h *Handler) DeleteUser(c *gin.Context) {
+	var req reasonReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	u, ok := h.userParam(c)
+	if !ok {
+		return
+	}
+	actor, ok := targetAllowed(c, u)
+	if !ok {
+		return
+	}
+
+	if err := h.repo.SoftDelete(u.ID); err != nil {
+		if errors.Is(err, user.ErrLastAdmin) {
+			c.JSON(http.StatusConflict, gin.H{"error": "cannot delete the last admin"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete"})
+		return
+	}
+	if !h.revokeAccess(c, u.ID) {
+		return
+	}
+	_ = h.audit.Create(&models.AdminAudit{ActorID: actor.UserID, Action: "delete_user", Target: "user:" + u.Email, Details: "reason: " + req.Reason})
+
+	c.JSON(http.StatusOK, gin.H{"status": "deleted"})
+}
+
+func (h *Handler) RestoreUser(c *gin.Context) {
+	var req reasonReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	u, err := h.repo.FindDeletedByID(uint(id))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed"})
+		return
+	}
+	if u == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "deleted user not found"})
+		return
+	}
+	actor, ok := targetAllowed(c, u)
+	if !ok {
+		return
+	}
+
+	if err := h.repo.Restore(u.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to restore"})
+		return
+	}
+	_ = h.audit.Create(&models.AdminAudit{ActorID: actor.UserID, Action: "restore_user", Target: "user:" + u.Email, Details: "reason: " + req.Reason})
+
+	c.JSON(http.StatusOK, gin.H{"status": "restored"})
+}
+
+// revokeAccess ends every session, access token and API key of the user,
+// writing the error response itself when that fails.
+func (h *Handler) revokeAccess(c *gin.Context, userID uint) bool {
+	if err := h.tokens.RevokeAllForUser(userID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to revoke"})
+		return false
+	}
+	if err := h.tokens.RevokeAllAPIKeys(userID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to revoke"})
+		return false
+	}
+	h.denylist.RevokeUser(c.Request.Context(), userID)
+	return true
+}
+
+// VerifyUser marks a user's email as verified without the emailed link.
+func (h *Handler) VerifyUser(c *gin.Context) {
+	u, ok := h.userParam(c)
+	if !ok {
+		return
+	}
+	if _, ok := targetAllowed(c, u); !ok {
+		return
+	}
+	if u.IsVerified {
+		c.JSON(http.StatusOK, gin.H{"status": "already_verified"})
+		return
+	}
+
+	if err := h.repo.MarkVerified(u.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to verify"})
+		return
+	}
+	_ = h.audit.Create(&models.AdminAudit{ActorID: actorID(c), Action: "verify_user", Target: "user:" + u.Email, Details: "email verified manually"})
+
+	c.JSON(http.StatusOK, gin.H{"status": "verified"})
+}
+
+// UnlockUser clears a login lockout before it expires on its own.
+func (h *Handler) UnlockUser(c *gin.Context) {
+	u, ok := h.userParam(c)
+	if !ok {
+		return
+	}
+	if _, ok := targetAllowed(c, u); !ok {
+		return
+	}
+
+	if err := h.limiter.Reset(c.Request.Context(), u.Email); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to unlock"})
+		return
+	}
+	_ = h.audit.Create(&models.AdminAudit{ActorID: actorID(c), Action: "unlock_user", Target: "user:" + u.Email, Details: "login lockout cleared"})
+
+	c.JSON(http.StatusOK, gin.H{"status": "unlocked"})
+}
+
+// ListSecurityEvents pages through security events, newest first, with
+// ?cursor and ?limit like ListAudit. Filters: user_id, event, created_after
+// and created_before.
+func (h *Handler) ListSecurityEvents(c *gin.Context) {
+	f := audit.SecurityEventFilter{Event: c.Query("event")}
+	if s := c.Query("user_id"); s != "" {
+		id, err := strconv.ParseUint(s, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user_id"})
+			return
+		}
+		f.UserID = uint(id)
+	}
+	var err error
+	if f.CreatedAfter, err = timeParam(c, "created_after"); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if f.CreatedBefore, err = timeParam(c, "created_before"); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	p, err := pagination.CursorFromQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	events, err := h.audit.ListSecurityEvents(f, p)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed"})
+		return
+	}
+	c.JSON(http.StatusOK, pagination.NewCursorPage(events, p, audit.SecurityEventCursor))
+}
+
+func (h *Handler) ListUserSessions(c *gin.Context) {
+	u, ok := h.userParam(c)
+	if !ok {
+		return
+	}
+	if _, ok := targetAllowed(c, u); !ok {
+		return
+	}
+	tokens, err := h.tokens.ListActiveSessions(u.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"sessions": auth.SessionList(tokens, "")})
+}
+
+func (h *Handler) RevokeUserSession(c *gin.Context) {
+	u, ok := h.userParam(c)
+	if !ok {
+		return
+	}
+	if _, ok := targetAllowed(c, u); !ok {
+		return
+	}
+	sid := c.Param("sid")
+	found, err := h.tokens.RevokeSession(u.ID, sid)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to revoke"})
+		return
+	}
+	if !found {
+		c.JSON(http.StatusNotFound, gin.H{"error": "session not found"})
+		return
+	}
+	h.denylist.RevokeSession(c.Request.Context(), sid)
+	_ = h.audit.Create(&models.AdminAudit{ActorID: actorID(c), Action: "revoke_session", Target: "user:" + u.Email, Details: "session " + sid + " revoked"})
+
+	c.JSON(http.StatusOK, gin.H{"status": "revoked"})
+}
+
+// ForceLogout revokes every session, access token and API key of a user.
+func (h *Handler) ForceLogout(c *gin.Context) {
+	u, ok := h.userParam(c)
+	if !ok {
+		return
+	}
+	if _, ok := targetAllowed(c, u); !ok {
+		return
+	}
+	if !h.revokeAccess(c, u.ID) {
+		return
+	}
+	_ = h.audit.Create(&models.AdminAudit{ActorID: actorID(c), Action: "force_logout", Target: "user:" + u.Email, Details: "all sessions and API keys revoked"})
+
+	c.JSON(http.StatusOK, gin.H{"status": "logged_out"})
+}
+
+type impersonateReq struct {
+	Reason string `json:"reason" binding:"required,max=500"`
+}
+
+// Impersonate issues a short-lived token acting as the user, for reproducing
+// their issues. It cannot be refreshed and is barred from account management.
+// Every request made with it gets an admin audit entry under the caller, by
+// the auth middleware (auth.AuditImpersonation).
+func (h *Handler) Impersonate(c *gin.Context) {
+	var req impersonateReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	u, ok := h.userParam(c)
+	if !ok {
+		return
+	}
+	v, _ := c.Get(auth.UserContextKey)
+	actor, _ := v.(*auth.Claims)
+	if actor == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthenticated"})
+		return
+	}
+	if u.ID == actor.UserID || u.Role.IsStaff() {
+		c.JSON(http.StatusForbidden, gin.H{"error": "cannot impersonate this user"})
+		return
+	}
+
+	tok, expires, err := h.imp.Issue(actor, u)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "token"})
+		return
+	}
+	_ = h.audit.Create(&models.AdminAudit{ActorID: actor.UserID, Action: "impersonate_user", Target: "user:" + u.Email, Details: "reason: " + req.Reason + "; until " + expires.UTC().Format(time.RFC3339)})
+
+	c.JSON(http.StatusOK, gin.H{"token": tok, "expires_at": expires, "impersonating": gin.H{"id": u.ID, "email": u.Email, "role": u.Role}})
+}
+
+// userParam loads the user named by the :id path parameter, writing the error
+// response itself when that fails.
+func (h *Handler) userParam(c *gin.Context) (*models.User, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return nil, false
+	}
+	u, err := h.repo.FindByID(uint(id))
+	if err != nil || u == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+		return nil, false
+	}
+	return u, true
+}
+
+// targetAllowed checks that the caller may change u's account: not their own,
+// and a staff account only if the caller is an admin. It writes the error
+// response itself when not.
+func targetAllowed(c *gin.Context, u *models.User) (*auth.Claims, bool) {
+	v, _ := c.Get(auth.UserContextKey)
+	actor, _ := v.(*auth.Claims)
+	if actor == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthenticated"})
+		return nil, false
+	}
+	if u.ID == actor.UserID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "cannot change your own account"})
+		return nil, false
+	}
+	if u.Role.IsStaff() && actor.Role != models.RoleAdmin {
+		c.JSON(http.StatusForbidden, gin.H{"error": "only admins can change staff accounts"})
+		return nil, false
+	}
+	return actor, true
+}
+
+// timeParam parses an optional RFC 3339 timestamp or YYYY-MM-DD date query
+// parameter; it returns the zero time when the parameter is absent.
+func timeParam(c *gin.Context, name string) (time.Time, error) {
+	s := c.Query(name)
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse(time.DateOnly, s); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("%s must be an RFC 3339 timestamp or YYYY-MM-DD date", name)
+}
+
+// actorID returns the acting admin's user ID from the JWT claims, or 0.
+func actorID(c *gin.Context) uint {
+	if v, ok := c.Get(auth.UserContextKey); ok {
+		if claims, ok := v.(*auth.Claims); ok {
+			return claims.UserID
+		}
+	}
+	return 0
 }
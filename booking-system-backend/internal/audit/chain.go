@@ -0,0 +1,236 @@
+package audit
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/temu-in/temu.in/booking-system-backend/internal/models"
+	"gorm.io/gorm"
+)
+
+// chainLockKey is the advisory lock that serializes appends, so each entry
+// links to the one inserted just before it.
+const chainLockKey = 7_211_094_317
+
+// Hash returns the chain hash of a: SHA-256 over its content and PrevHash.
+// The id is left out since it is only known after the insert.
+func Hash(a *models.AdminAudit) string {
+	// a JSON array keeps field boundaries unambiguous
+	b, _ := json.Marshal([]string{
+		a.PrevHash,
+		a.CreatedAt.UTC().Format(time.RFC3339Nano),
+		strconv.FormatUint(uint64(a.ActorID), 10),
+		a.Action,
+		a.Target,
+		a.Details,
+	})
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+// Create appends a to the chain.
+func (r *Repository) Create(a *models.AdminAudit) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(?)", chainLockKey).Error; err != nil {
+			return err
+		}
+		prev, err := lastHash(tx)
+		if err != nil {
+			return err
+		}
+		// stored with microsecond precision; hash what will be read back
+		a.CreatedAt = time.Now().UTC().Truncate(time.Microsecond)
+		a.PrevHash = prev
+		a.Hash = Hash(a)
+		if err := tx.Create(a).Error; err != nil {
+			return err
+		}
+		return tx.Exec(`INSERT INTO audit_chain_heads (id, hash, entries, updated_at) VALUES (1, ?, 1, ?)
+ON CONFLICT (id) DO UPDATE SET hash = EXCLUDED.hash, entries = audit_chain_heads.entries + 1, updated_at = EXCLUDED.updated_at`, a.Hash, a.CreatedAt).Error
+	})
+}
+
+func lastHash(tx *gorm.DB) (string, error) {
+	var hashes []string
+	err := tx.Model(&models.AdminAudit{}).Order("id desc").Limit(1).Pluck("hash", &hashes).Error
+	if err != nil || len(hashes) == 0 {
+		return "", err
+	}
+	return hashes[0], nil
+}
+
+// Head marks the end of the chain at some point in time: the number of
+// entries and the hash of the last one.
+type Head struct {
+	Entries int64  `json:"entries"`
+	Hash    string `json:"hash"`
+}
+
+// VerifyResult is the outcome of walking the chain. BrokenAt is the id of the
+// first entry that does not check out, with Reason saying why; it is zero when
+// the whole chain is intact, or when it is intact but ends before a recorded
+// head. Head is the hash of the last entry checked, which auditors can record
+// along with Checked to detect later truncation of the log.
+type VerifyResult struct {
+	OK       bool   `json:"ok"`
+	Checked  int    `json:"checked"`
+	BrokenAt uint   `json:"broken_at,omitempty"`
+	Reason   string `json:"reason,omitempty"`
+	Head     string `json:"head,omitempty"`
+}
+
+// Verify walks the chain in insertion order and reports the first broken
+// link: an entry whose content no longer matches its hash, or whose PrevHash
+// does not match the entry before it (an edit or a removed row). The chain
+// must also pass through the head kept in audit_chain_heads and through any
+// heads recorded earlier by the caller, which catches entries removed from
+// the end.
+func (r *Repository) Verify(ctx context.Context, recorded ...Head) (VerifyResult, error) {
+	var res VerifyResult
+	// read before the entries, so concurrent appends only make the chain longer
+	var heads []models.AuditChainHead
+	if err := r.db.WithContext(ctx).Limit(1).Find(&heads).Error; err != nil {
+		return res, err
+	}
+	for _, h := range heads {
+		recorded = append(recorded, Head{Entries: h.Entries, Hash: h.Hash})
+	}
+	rows, err := r.db.WithContext(ctx).Model(&models.AdminAudit{}).Order("id").Rows()
+	if err != nil {
+		return res, err
+	}
+	defer rows.Close()
+	prev := ""
+	for rows.Next() {
+		var a models.AdminAudit
+		if err := r.db.ScanRows(rows, &a); err != nil {
+			return res, err
+		}
+		switch {
+		case a.PrevHash != prev:
+			res.BrokenAt, res.Reason = a.ID, "previous hash does not match; an entry before it was changed or removed"
+		case Hash(&a) != a.Hash:
+			res.BrokenAt, res.Reason = a.ID, "content does not match its hash"
+		case !passes(recorded, int64(res.Checked+1), a.Hash):
+			res.BrokenAt, res.Reason = a.ID, "does not match the recorded head; the log was rewritten from here"
+		}
+		if res.BrokenAt != 0 {
+			return res, nil
+		}
+		res.Checked++
+		res.Head = a.Hash
+		prev = a.Hash
+	}
+	if err := rows.Err(); err != nil {
+		return res, err
+	}
+	for _, h := range recorded {
+		if h.Entries > int64(res.Checked) {
+			res.Reason = fmt.Sprintf("chain ends after %d entries but a head at %d was recorded; entries were removed from the end", res.Checked, h.Entries)
+			return res, nil
+		}
+	}
+	res.OK = true
+	return res, nil
+}
+
+// passes reports whether an entry with hash at position n agrees with every
+// head recorded at that position.
+func passes(heads []Head, n int64, hash string) bool {
+	for _, h := range heads {
+		if h.Entries == n && h.Hash != hash {
+			return false
+		}
+	}
+	return true
+}
+
+// Migrate chains entries written before the log was hashed, records the
+// chain head if there is none yet, and installs triggers that reject UPDATE,
+// DELETE and TRUNCATE on admin_audits, so rows cannot be changed outside GORM
+// either. Only unhashed rows may still be updated, which is what the backfill
+// needs. The head may only move forward.
+func Migrate(db *gorm.DB) error {
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(?)", chainLockKey).Error; err != nil {
+			return err
+		}
+		var pending []models.AdminAudit
+		if err := tx.Where("hash = ''").Order("id").Find(&pending).Error; err != nil {
+			return err
+		}
+		if len(pending) == 0 {
+			return initHead(tx)
+		}
+		var prev string
+		var before []string
+		if err := tx.Model(&models.AdminAudit{}).Where("hash <> '' AND id < ?", pending[0].ID).Order("id desc").Limit(1).Pluck("hash", &before).Error; err != nil {
+			return err
+		}
+		if len(before) > 0 {
+			prev = before[0]
+		}
+		for i := range pending {
+			a := &pending[i]
+			a.CreatedAt = a.CreatedAt.UTC().Truncate(time.Microsecond)
+			a.PrevHash = prev
+			a.Hash = Hash(a)
+			if err := tx.Exec("UPDATE admin_audits SET prev_hash = ?, hash = ? WHERE id = ?", a.PrevHash, a.Hash, a.ID).Error; err != nil {
+				return fmt.Errorf("chain entry %d: %w", a.ID, err)
+			}
+			prev = a.Hash
+		}
+		return initHead(tx)
+	})
+	if err != nil {
+		return err
+	}
+
+	stmts := []string{
+		"CREATE INDEX IF NOT EXISTS idx_admin_audits_target_prefix ON admin_audits (target text_pattern_ops)",
+		`CREATE OR REPLACE FUNCTION admin_audits_append_only() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP = 'UPDATE' AND OLD.hash = '' THEN
+        RETURN NEW;
+    END IF;
+    RAISE EXCEPTION 'admin_audits is append-only';
+END;
+$$ LANGUAGE plpgsql`,
+		"DROP TRIGGER IF EXISTS admin_audits_append_only ON admin_audits",
+		"CREATE TRIGGER admin_audits_append_only BEFORE UPDATE OR DELETE ON admin_audits FOR EACH ROW EXECUTE FUNCTION admin_audits_append_only()",
+		// row triggers do not fire on TRUNCATE
+		"DROP TRIGGER IF EXISTS admin_audits_no_truncate ON admin_audits",
+		"CREATE TRIGGER admin_audits_no_truncate BEFORE TRUNCATE ON admin_audits FOR EACH STATEMENT EXECUTE FUNCTION admin_audits_append_only()",
+		`CREATE OR REPLACE FUNCTION audit_chain_heads_forward_only() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP = 'UPDATE' AND NEW.entries > OLD.entries THEN
+        RETURN NEW;
+    END IF;
+    RAISE EXCEPTION 'audit_chain_heads only moves forward';
+END;
+$$ LANGUAGE plpgsql`,
+		"DROP TRIGGER IF EXISTS audit_chain_heads_forward_only ON audit_chain_heads",
+		"CREATE TRIGGER audit_chain_heads_forward_only BEFORE UPDATE OR DELETE ON audit_chain_heads FOR EACH ROW EXECUTE FUNCTION audit_chain_heads_forward_only()",
+		"DROP TRIGGER IF EXISTS audit_chain_heads_no_truncate ON audit_chain_heads",
+		"CREATE TRIGGER audit_chain_heads_no_truncate BEFORE TRUNCATE ON audit_chain_heads FOR EACH STATEMENT EXECUTE FUNCTION audit_chain_heads_forward_only()",
+	}
+	for _, stmt := range stmts {
+		if err := db.Exec(stmt).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// initHead records the current end of the chain as its head, unless a head
+// is already kept.
+func initHead(tx *gorm.DB) error {
+	return tx.Exec(`INSERT INTO audit_chain_heads (id, hash, entries, updated_at)
+SELECT 1, COALESCE((SELECT hash FROM admin_audits ORDER BY id DESC LIMIT 1), ''), (SELECT count(*) FROM admin_audits), now()
+ON CONFLICT (id) DO NOTHING`).Error
+}
@@ -0,0 +1,160 @@
+package audit
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"github.com/temu-in/temu.in/booking-system-backend/internal/models"
+)
+
+func TestHash(t *testing.T) {
+	base := models.AdminAudit{
+		CreatedAt: time.Date(2026, 1, 2, 3, 4, 5, 6000, time.UTC),
+		ActorID:   1,
+		Action:    "suspend_user",
+		Target:    "user:ana@example.com",
+		Details:   "reason: spam",
+		PrevHash:  "abc",
+	}
+	want := Hash(&base)
+	if len(want) != 64 {
+		t.Fatalf("hash %q is not hex SHA-256", want)
+	}
+	same := base
+	same.ID, same.Hash = 99, "ignored"
+	same.CreatedAt = base.CreatedAt.In(time.FixedZone("WIB", 7*3600))
+	if Hash(&same) != want {
+		t.Error("hash depends on the id, the stored hash or the time zone")
+	}
+
+	changes := map[string]func(a *models.AdminAudit){
+		"created_at": func(a *models.AdminAudit) { a.CreatedAt = a.CreatedAt.Add(time.Microsecond) },
+		"actor_id":   func(a *models.AdminAudit) { a.ActorID = 2 },
+		"action":     func(a *models.AdminAudit) { a.Action = "unsuspend_user" },
+		"target":     func(a *models.AdminAudit) { a.Target = "user:bob@example.com" },
+		"details":    func(a *models.AdminAudit) { a.Details = "reason: spam " },
+		"prev_hash":  func(a *models.AdminAudit) { a.PrevHash = "abd" },
+		// moving text between fields must not collide
+		"boundary": func(a *models.AdminAudit) { a.Target, a.Details = a.Target+"reason:", " spam" },
+	}
+	for name, change := range changes {
+		a := base
+		change(&a)
+		if Hash(&a) == want {
+			t.Errorf("changing %s keeps the hash", name)
+		}
+	}
+}
+
+// chainDB returns a repository over an in-memory database holding a chain of
+// n entries, with ids 1..n, and their hashes. It records a chain head only
+// when withHead is set.
+func chainDB(t *testing.T, n int, withHead bool) (*Repository, *gorm.DB, []string) {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+	if err := db.AutoMigrate(&models.AdminAudit{}, &models.AuditChainHead{}); err != nil {
+		t.Fatal(err)
+	}
+
+	// what Create does, minus the postgres advisory lock
+	var hashes []string
+	prev := ""
+	start := time.Now().UTC().Truncate(time.Microsecond)
+	for i := 0; i < n; i++ {
+		a := &models.AdminAudit{CreatedAt: start.Add(time.Duration(i) * time.Second), ActorID: 1, Action: "change_role", Target: "user:ana@example.com", Details: "step " + string(rune('a'+i)), PrevHash: prev}
+		a.Hash = Hash(a)
+		if err := db.Create(a).Error; err != nil {
+			t.Fatal(err)
+		}
+		hashes = append(hashes, a.Hash)
+		prev = a.Hash
+	}
+	if withHead && n > 0 {
+		if err := db.Create(&models.AuditChainHead{ID: 1, Hash: prev, Entries: int64(n)}).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	return NewRepository(db), db, hashes
+}
+
+func TestVerify(t *testing.T) {
+	ctx := context.Background()
+	cases := []struct {
+		name     string
+		withHead bool
+		tamper   string // SQL run on the chain of 4 entries
+		recorded func(hashes []string) []Head
+		ok       bool
+		checked  int
+		brokenAt uint
+		reason   string
+	}{
+		{name: "intact", withHead: true, ok: true, checked: 4},
+		{name: "intact without head", ok: true, checked: 4},
+		{name: "edited", withHead: true, tamper: "UPDATE admin_audits SET details = 'step x' WHERE id = 2", checked: 1, brokenAt: 2, reason: "content does not match"},
+		{name: "forged hash", withHead: true, tamper: "UPDATE admin_audits SET hash = 'forged' WHERE id = 2", checked: 1, brokenAt: 2, reason: "content does not match"},
+		{name: "removed middle", withHead: true, tamper: "DELETE FROM admin_audits WHERE id = 2", checked: 1, brokenAt: 3, reason: "previous hash does not match"},
+		{name: "removed first", withHead: true, tamper: "DELETE FROM admin_audits WHERE id = 1", brokenAt: 2, reason: "previous hash does not match"},
+		{name: "truncated tail", withHead: true, tamper: "DELETE FROM admin_audits WHERE id >= 3", checked: 2, reason: "removed from the end"},
+		{name: "emptied", withHead: true, tamper: "DELETE FROM admin_audits", reason: "removed from the end"},
+		{
+			name:     "truncated tail and head",
+			withHead: true,
+			tamper:   "DELETE FROM admin_audits WHERE id = 4; UPDATE audit_chain_heads SET entries = 3, hash = (SELECT hash FROM admin_audits WHERE id = 3)",
+			recorded: func(h []string) []Head { return []Head{{Entries: 4, Hash: h[3]}} },
+			checked:  3,
+			reason:   "removed from the end",
+		},
+		{
+			name:     "earlier head still on the chain",
+			recorded: func(h []string) []Head { return []Head{{Entries: 2, Hash: h[1]}} },
+			ok:       true,
+			checked:  4,
+		},
+		{
+			name:     "earlier head not on the chain",
+			recorded: func(h []string) []Head { return []Head{{Entries: 2, Hash: "rewritten"}} },
+			checked:  1,
+			brokenAt: 2,
+			reason:   "recorded head",
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			repo, db, hashes := chainDB(t, 4, tc.withHead)
+			for _, stmt := range strings.Split(tc.tamper, ";") {
+				if stmt = strings.TrimSpace(stmt); stmt != "" {
+					if err := db.Exec(stmt).Error; err != nil {
+						t.Fatal(err)
+					}
+				}
+			}
+			var recorded []Head
+			if tc.recorded != nil {
+				recorded = tc.recorded(hashes)
+			}
+			res, err := repo.Verify(ctx, recorded...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.OK != tc.ok || res.Checked != tc.checked || res.BrokenAt != tc.brokenAt || !strings.Contains(res.Reason, tc.reason) {
+				t.Errorf("Verify = %+v; want ok %v, checked %d, broken at %d, reason containing %q", res, tc.ok, tc.checked, tc.brokenAt, tc.reason)
+			}
+			if tc.ok && res.Head != hashes[len(hashes)-1] {
+				t.Errorf("head = %q, want the last hash", res.Head)
+			}
+		})
+	}
+}
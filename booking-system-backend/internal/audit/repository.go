@@ -1,22 +1,130 @@
 package audit
 
 import (
-    "github.com/temu-in/temu.in/booking-system-backend/internal/models"
-    "gorm.io/gorm"
+	"context"
+	"time"
+
+	"github.com/temu-in/temu.in/booking-system-backend/internal/models"
+	"github.com/temu-in/temu.in/booking-system-backend/internal/pagination"
+	"gorm.io/gorm"
 )
 
-type Repository struct{
-    db *gorm.DB
+type Repository struct {
+	db *gorm.DB
 }
 
 func NewRepository(db *gorm.DB) *Repository { return &Repository{db: db} }
 
-func (r *Repository) Create(a *models.AdminAudit) error { return r.db.Create(a).Error }
+// Filter narrows List and Stream. Zero values match everything.
+type Filter struct {
+	ActorID       uint
+	Action        string
+	TargetPrefix  string
+	CreatedAfter  time.Time
+	CreatedBefore time.Time
+}
+
+func (f Filter) apply(q *gorm.DB) *gorm.DB {
+	if f.ActorID != 0 {
+		q = q.Where("actor_id = ?", f.ActorID)
+	}
+	if f.Action != "" {
+		q = q.Where("action = ?", f.Action)
+	}
+	if f.TargetPrefix != "" {
+		q = q.Where("target LIKE ?", pagination.EscapeLike(f.TargetPrefix)+"%")
+	}
+	if !f.CreatedAfter.IsZero() {
+		q = q.Where("created_at >= ?", f.CreatedAfter)
+	}
+	if !f.CreatedBefore.IsZero() {
+		q = q.Where("created_at < ?", f.CreatedBefore)
+	}
+	return q
+}
+
+// List returns the entries matching f, newest first, starting after p.After.
+// It fetches one row more than p.Limit; see pagination.NewCursorPage.
+func (r *Repository) List(f Filter, p pagination.CursorParams) ([]models.AdminAudit, error) {
+	q := f.apply(r.db.Model(&models.AdminAudit{}))
+	if p.After != nil {
+		q = q.Where("(created_at, id) < (?, ?)", p.After.CreatedAt, p.After.ID)
+	}
+	var out []models.AdminAudit
+	if err := q.Order("created_at desc, id desc").Limit(p.Limit + 1).Find(&out).Error; err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// AuditCursor is the position of an entry in List.
+func AuditCursor(a models.AdminAudit) pagination.Cursor {
+	return pagination.Cursor{CreatedAt: a.CreatedAt, ID: a.ID}
+}
+
+// Stream calls fn for every entry matching f, oldest first, reading rows one
+// at a time so exports of any size run in constant memory. It stops at the
+// first error from fn.
+func (r *Repository) Stream(ctx context.Context, f Filter, fn func(*models.AdminAudit) error) error {
+	rows, err := f.apply(r.db.WithContext(ctx).Model(&models.AdminAudit{})).Order("created_at, id").Rows()
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var a models.AdminAudit
+		if err := r.db.ScanRows(rows, &a); err != nil {
+			return err
+		}
+		if err := fn(&a); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+func (r *Repository) CreateSecurityEvent(e *models.SecurityEvent) error { return r.db.Create(e).Error }
+
+// SecurityEventFilter narrows ListSecurityEvents. Zero values match
+// everything.
+type SecurityEventFilter struct {
+	UserID        uint
+	Event         string
+	CreatedAfter  time.Time
+	CreatedBefore time.Time
+}
+
+func (f SecurityEventFilter) apply(q *gorm.DB) *gorm.DB {
+	if f.UserID != 0 {
+		q = q.Where("user_id = ?", f.UserID)
+	}
+	if f.Event != "" {
+		q = q.Where("event = ?", f.Event)
+	}
+	if !f.CreatedAfter.IsZero() {
+		q = q.Where("created_at >= ?", f.CreatedAfter)
+	}
+	if !f.CreatedBefore.IsZero() {
+		q = q.Where("created_at < ?", f.CreatedBefore)
+	}
+	return q
+}
+
+// ListSecurityEvents returns the events matching f, newest first, starting
+// after p.After. Like List it fetches one row more than p.Limit.
+func (r *Repository) ListSecurityEvents(f SecurityEventFilter, p pagination.CursorParams) ([]models.SecurityEvent, error) {
+	q := f.apply(r.db.Model(&models.SecurityEvent{}))
+	if p.After != nil {
+		q = q.Where("(created_at, id) < (?, ?)", p.After.CreatedAt, p.After.ID)
+	}
+	var out []models.SecurityEvent
+	if err := q.Order("created_at desc, id desc").Limit(p.Limit + 1).Find(&out).Error; err != nil {
+		return nil, err
+	}
+	return out, nil
+}
 
-func (r *Repository) ListAll() ([]models.AdminAudit, error) {
-    var out []models.AdminAudit
-    if err := r.db.Order("created_at desc").Find(&out).Error; err != nil {
-        return nil, err
-    }
-    return out, nil
+// SecurityEventCursor is the position of an event in ListSecurityEvents.
+func SecurityEventCursor(e models.SecurityEvent) pagination.Cursor {
+	return pagination.Cursor{CreatedAt: e.CreatedAt, ID: e.ID}
 }
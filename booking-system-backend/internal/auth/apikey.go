@@ -0,0 +1,257 @@
+package auth
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/temu-in/temu.in/booking-system-backend/internal/models"
+	"github.com/temu-in/temu.in/booking-system-backend/internal/token"
+	"github.com/temu-in/temu.in/booking-system-backend/internal/user"
+)
+
+// API key scopes. Interactive sessions are not scoped; a key can only reach
+// routes guarded by a scope it was granted.
+const (
+	ScopeProfileRead   = "profile:read"
+	ScopeBookingsRead  = "bookings:read"
+	ScopeBookingsWrite = "bookings:write"
+	ScopeAdminUsers    = "admin:users"
+	ScopeAdminAudit    = "admin:audit"
+)
+
+// Scopes lists every scope a key may be granted.
+var Scopes = []string{ScopeProfileRead, ScopeBookingsRead, ScopeBookingsWrite, ScopeAdminUsers, ScopeAdminAudit}
+
+// APIKeyPrefix starts every API key, which is how Middleware tells keys from
+// JWTs and what secret scanners can match on.
+const APIKeyPrefix = "tmu_"
+
+const (
+	EventAPIKeyCreated = "api_key_created"
+	EventAPIKeyRevoked = "api_key_revoked"
+)
+
+// IsAPIKey reports whether the principal authenticated with an API key rather
+// than a session.
+func (c *Claims) IsAPIKey() bool {
+	return c.APIKeyID != 0
+}
+
+// HasScope reports whether the principal may use routes guarded by scope.
+// Sessions carry every scope their role allows.
+func (c *Claims) HasScope(scope string) bool {
+	return !c.IsAPIKey() || slices.Contains(c.Scopes, scope)
+}
+
+// AcceptAPIKeys lets Middleware authenticate "Bearer tmu_..." API keys in
+// addition to JWTs.
+func AcceptAPIKeys(tokens *token.Repository, users *user.Repository) MiddlewareOption {
+	return func(mc *middlewareConfig) { mc.apiKeys = &apiKeyAuth{tokens: tokens, users: users} }
+}
+
+type apiKeyAuth struct {
+	tokens *token.Repository
+	users  *user.Repository
+}
+
+// principal resolves a raw key into claims for its owner, or nil when the key
+// is not valid. The role is read from the user so role changes apply at once.
+func (a *apiKeyAuth) principal(raw string) (*Claims, error) {
+	k, err := a.tokens.FindAPIKey(hashToken(raw))
+	if err != nil || k == nil {
+		return nil, err
+	}
+	u, err := a.users.FindByID(k.UserID)
+	if err != nil || u == nil {
+		return nil, err
+	}
+	if u.Suspended(time.Now()) {
+		return nil, nil
+	}
+	if err := a.tokens.TouchAPIKey(k); err != nil {
+		// bookkeeping only; the key itself is fine
+		log.Printf("api key %d: record last use: %v", k.ID, err)
+	}
+	return &Claims{
+		UserID:   u.ID,
+		Role:     u.Role,
+		AMR:      strings.Fields(k.AMR),
+		Scopes:   strings.Fields(k.Scopes),
+		APIKeyID: k.ID,
+		Version:  u.SecurityVersion,
+		Verified: u.IsVerified,
+	}, nil
+}
+
+// RequireScope rejects API keys that were not granted scope. Sessions pass.
+func RequireScope(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, ok := claimsFrom(c)
+		if !ok {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "missing claims"})
+			return
+		}
+		if !claims.HasScope(scope) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "insufficient scope", "scope": scope})
+			return
+		}
+		c.Next()
+	}
+}
+
+// RequireSession admits only the account owner's own interactive session,
+// rejecting API keys and impersonation tokens. It guards account management
+// (sessions, keys, 2FA, password) so neither a leaked key nor a staff member
+// acting as the user can take over the account.
+func RequireSession() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, ok := claimsFrom(c)
+		if !ok {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "missing claims"})
+			return
+		}
+		if claims.IsAPIKey() {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "not allowed with an api key"})
+			return
+		}
+		if claims.IsImpersonation() {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "not allowed while impersonating"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// RegisterAPIKeyRoutes mounts the self-service API key endpoints under
+// /api/me; rg must already require an interactive session.
+func (h *Handler) RegisterAPIKeyRoutes(rg *gin.RouterGroup) {
+	rg.GET("/api-keys", h.ListAPIKeys)
+	rg.POST("/api-keys", h.CreateAPIKey)
+	rg.DELETE("/api-keys/:id", h.RevokeAPIKey)
+}
+
+func (h *Handler) ListAPIKeys(c *gin.Context) {
+	claims, ok := claimsFrom(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthenticated"})
+		return
+	}
+	keys, err := h.tokens.ListAPIKeys(claims.UserID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"api_keys": keys})
+}
+
+type createAPIKeyReq struct {
+	Name   string   `json:"name" binding:"required,max=100"`
+	Scopes []string `json:"scopes" binding:"required,min=1"`
+	// ExpiresAt defaults to API_KEY_DEFAULT_TTL from now and may not be later
+	// than API_KEY_MAX_TTL from now.
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+// CreateAPIKey mints a key for the caller. The raw key is only ever returned
+// here.
+func (h *Handler) CreateAPIKey(c *gin.Context) {
+	var req createAPIKeyReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	claims, ok := claimsFrom(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthenticated"})
+		return
+	}
+	u, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+
+	for _, s := range req.Scopes {
+		if !slices.Contains(Scopes, s) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "unknown scope", "scope": s})
+			return
+		}
+		if strings.HasPrefix(s, "admin:") && !u.Role.IsStaff() {
+			c.JSON(http.StatusForbidden, gin.H{"error": "scope requires a staff role", "scope": s})
+			return
+		}
+	}
+	now := time.Now()
+	expires := now.Add(h.config.APIKeyDefaultTTL)
+	if req.ExpiresAt != nil {
+		expires = *req.ExpiresAt
+	}
+	if !expires.After(now) || expires.After(now.Add(h.config.APIKeyMaxTTL)) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid expires_at"})
+		return
+	}
+
+	raw, prefix, err := newAPIKey()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal"})
+		return
+	}
+	scopes := slices.Compact(slices.Sorted(slices.Values(req.Scopes)))
+	rec := &models.APIKey{
+		UserID: u.ID, Name: req.Name, Prefix: prefix, KeyHash: hashToken(raw),
+		Scopes: strings.Join(scopes, " "), AMR: strings.Join(claims.AMR, " "), ExpiresAt: expires,
+	}
+	if err := h.tokens.CreateAPIKey(rec); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed"})
+		return
+	}
+	h.securityEvent(c, EventAPIKeyCreated, u.ID, fmt.Sprintf("key=%d scopes=%s", rec.ID, rec.Scopes))
+
+	c.JSON(http.StatusCreated, gin.H{"api_key": rec, "key": raw})
+}
+
+func (h *Handler) RevokeAPIKey(c *gin.Context) {
+	claims, ok := claimsFrom(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthenticated"})
+		return
+	}
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	found, err := h.tokens.RevokeAPIKey(claims.UserID, uint(id))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed"})
+		return
+	}
+	if !found {
+		c.JSON(http.StatusNotFound, gin.H{"error": "api key not found"})
+		return
+	}
+	h.securityEvent(c, EventAPIKeyRevoked, claims.UserID, fmt.Sprintf("key=%d", id))
+	c.JSON(http.StatusOK, gin.H{"status": "revoked"})
+}
+
+// newAPIKey returns a raw key "tmu_<prefix>_<secret>" and its prefix.
+func newAPIKey() (string, string, error) {
+	b := make([]byte, 4)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	prefix := hex.EncodeToString(b)
+	secret, err := generateSecureToken(32)
+	if err != nil {
+		return "", "", err
+	}
+	return APIKeyPrefix + prefix + "_" + secret, prefix, nil
+}
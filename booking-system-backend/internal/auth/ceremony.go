@@ -0,0 +1,90 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// ceremonyStore keeps the server half of multi-step browser flows, such as a
+// WebAuthn challenge, between the request that starts them and the one that
+// finishes them. Entries live in Redis so any instance can finish a ceremony;
+// without Redis they are kept in process memory. Each entry can be taken once.
+type ceremonyStore struct {
+	cache *redis.Client
+
+	mu  sync.Mutex
+	mem map[string]ceremonyEntry
+}
+
+type ceremonyEntry struct {
+	data    []byte
+	expires time.Time
+}
+
+func newCeremonyStore(cache *redis.Client) *ceremonyStore {
+	return &ceremonyStore{cache: cache, mem: map[string]ceremonyEntry{}}
+}
+
+func ceremonyKey(kind, id string) string { return "ceremony:" + kind + ":" + id }
+
+// put stores v as JSON for ttl and returns the id the client echoes back.
+func (s *ceremonyStore) put(ctx context.Context, kind string, v interface{}, ttl time.Duration) (string, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	id, err := generateSecureToken(24)
+	if err != nil {
+		return "", err
+	}
+	key := ceremonyKey(kind, id)
+	if s.cache != nil {
+		return id, s.cache.Set(ctx, key, data, ttl).Err()
+	}
+
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for k, e := range s.mem {
+		if now.After(e.expires) {
+			delete(s.mem, k)
+		}
+	}
+	s.mem[key] = ceremonyEntry{data: data, expires: now.Add(ttl)}
+	return id, nil
+}
+
+// take loads and removes the entry into v. It reports false when the id is
+// unknown, expired or already used.
+func (s *ceremonyStore) take(ctx context.Context, kind, id string, v interface{}) (bool, error) {
+	if id == "" {
+		return false, nil
+	}
+	key := ceremonyKey(kind, id)
+	var data []byte
+	if s.cache != nil {
+		b, err := s.cache.GetDel(ctx, key).Bytes()
+		if errors.Is(err, redis.Nil) {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		data = b
+	} else {
+		s.mu.Lock()
+		e, ok := s.mem[key]
+		delete(s.mem, key)
+		s.mu.Unlock()
+		if !ok || time.Now().After(e.expires) {
+			return false, nil
+		}
+		data = e.data
+	}
+	return true, json.Unmarshal(data, v)
+}
@@ -0,0 +1,287 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/temu-in/temu.in/booking-system-backend/internal/token"
+)
+
+// Denylist tracks access tokens that were revoked before they expired. Entries
+// live in Redis so every instance sees them; a process-local copy is always
+// kept as well, so revocations made by this instance still hold while Redis is
+// unreachable. With a Subscriber attached the local copy also receives other
+// instances' entries and most checks never leave the process.
+type Denylist struct {
+	cache *redis.Client
+	ttl   time.Duration     // access-token lifetime
+	sub   *token.Subscriber // optional; see Attach
+
+	mu    sync.Mutex
+	jtis  map[string]time.Time // jti -> expiry
+	sids  map[string]time.Time // session (refresh family) -> expiry
+	users map[uint]userCutoff
+}
+
+type userCutoff struct {
+	before  time.Time // tokens issued before this instant are revoked
+	expires time.Time
+}
+
+// NewDenylist creates a denylist for access tokens living at most accessTTL.
+// cache may be nil, in which case only the process-local store is used.
+func NewDenylist(cache *redis.Client, accessTTL time.Duration) *Denylist {
+	return &Denylist{cache: cache, ttl: accessTTL, jtis: map[string]time.Time{}, sids: map[string]time.Time{}, users: map[uint]userCutoff{}}
+}
+
+// Redis key prefixes of denylist entries.
+const (
+	jtiPrefix  = "revoked_jti:"
+	sidPrefix  = "revoked_sid:"
+	userPrefix = "revoked_user_tokens:"
+)
+
+func jtiKey(jti string) string   { return jtiPrefix + jti }
+func sidKey(sid string) string   { return sidPrefix + sid }
+func userKey(userID uint) string { return fmt.Sprintf("%s%d", userPrefix, userID) }
+
+// ChannelRevokedAccess announces denylist entries to other instances.
+const ChannelRevokedAccess = "revoked_access"
+
+// Revoke denylists a single token until it would have expired anyway.
+func (d *Denylist) Revoke(ctx context.Context, jti string, expiresAt time.Time) {
+	ttl := time.Until(expiresAt)
+	if jti == "" || ttl <= 0 {
+		return
+	}
+	d.addJTI(jti, expiresAt)
+	d.store(ctx, jtiKey(jti), "1", ttl, fmt.Sprintf("jti:%s:%d", jti, expiresAt.Unix()))
+}
+
+// RevokeSession invalidates every access token minted from one session.
+func (d *Denylist) RevokeSession(ctx context.Context, sid string) {
+	if sid == "" {
+		return
+	}
+	exp := time.Now().Add(d.ttl)
+	d.addSID(sid, exp)
+	d.store(ctx, sidKey(sid), "1", d.ttl, fmt.Sprintf("sid:%s:%d", sid, exp.Unix()))
+}
+
+// RevokeUser invalidates every access token issued to the user before now,
+// e.g. after a password reset. Token issue times have whole-second precision,
+// so the cutoff is the start of the current second: a token issued in that
+// second, such as the one for the session that caused the revocation, stays
+// valid. The entry only needs to outlive the access-token TTL.
+func (d *Denylist) RevokeUser(ctx context.Context, userID uint) {
+	now := time.Now().Truncate(time.Second)
+	exp := now.Add(d.ttl)
+	d.addUser(userID, now, exp)
+	d.store(ctx, userKey(userID), now.Unix(), d.ttl, fmt.Sprintf("user:%d:%d:%d", userID, now.Unix(), exp.Unix()))
+}
+
+// store persists an entry in Redis and announces it to other instances.
+func (d *Denylist) store(ctx context.Context, key string, value interface{}, ttl time.Duration, announce string) {
+	if d.cache == nil {
+		return
+	}
+	if err := d.cache.Set(ctx, key, value, ttl).Err(); err != nil {
+		log.Printf("denylist: redis set %s: %v", key, err)
+		return
+	}
+	if err := d.cache.Publish(ctx, ChannelRevokedAccess, announce).Err(); err != nil {
+		log.Printf("denylist: publish %s: %v", key, err)
+	}
+}
+
+func (d *Denylist) addJTI(jti string, exp time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.jtis[jti] = exp
+	d.pruneLocked()
+}
+
+func (d *Denylist) addSID(sid string, exp time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.sids[sid] = exp
+	d.pruneLocked()
+}
+
+func (d *Denylist) addUser(userID uint, before, exp time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if cur, ok := d.users[userID]; ok && cur.before.After(before) {
+		return
+	}
+	d.users[userID] = userCutoff{before: before, expires: exp}
+	d.pruneLocked()
+}
+
+// Attach keeps the local store in sync with other instances through sub. While
+// sub is healthy IsRevoked answers from memory without asking Redis.
+func (d *Denylist) Attach(sub *token.Subscriber) {
+	d.sub = sub
+	sub.Handle(ChannelRevokedAccess, d.apply)
+	sub.OnConnect(d.warm)
+}
+
+// apply handles one announcement: "jti:<id>:<exp>", "sid:<id>:<exp>" or
+// "user:<id>:<before>:<exp>", times in unix seconds.
+func (d *Denylist) apply(payload string) {
+	parts := strings.Split(payload, ":")
+	unix := func(s string) (time.Time, bool) {
+		n, err := strconv.ParseInt(s, 10, 64)
+		return time.Unix(n, 0), err == nil
+	}
+	switch {
+	case len(parts) == 3 && parts[0] == "jti":
+		if exp, ok := unix(parts[2]); ok {
+			d.addJTI(parts[1], exp)
+		}
+	case len(parts) == 3 && parts[0] == "sid":
+		if exp, ok := unix(parts[2]); ok {
+			d.addSID(parts[1], exp)
+		}
+	case len(parts) == 4 && parts[0] == "user":
+		id, err := strconv.ParseUint(parts[1], 10, 64)
+		before, ok1 := unix(parts[2])
+		exp, ok2 := unix(parts[3])
+		if err == nil && ok1 && ok2 {
+			d.addUser(uint(id), before, exp)
+		}
+	}
+}
+
+// warm loads every entry currently in Redis, covering whatever was published
+// while this instance was not subscribed.
+func (d *Denylist) warm(ctx context.Context) error {
+	scan := func(pattern string, fn func(key string, ttl time.Duration) error) error {
+		iter := d.cache.Scan(ctx, 0, pattern, 500).Iterator()
+		for iter.Next(ctx) {
+			key := iter.Val()
+			ttl, err := d.cache.PTTL(ctx, key).Result()
+			if err != nil {
+				return err
+			}
+			if ttl <= 0 {
+				continue
+			}
+			if err := fn(key, ttl); err != nil {
+				return err
+			}
+		}
+		return iter.Err()
+	}
+
+	if err := scan(jtiPrefix+"*", func(key string, ttl time.Duration) error {
+		d.addJTI(strings.TrimPrefix(key, jtiPrefix), time.Now().Add(ttl))
+		return nil
+	}); err != nil {
+		return err
+	}
+	if err := scan(sidPrefix+"*", func(key string, ttl time.Duration) error {
+		d.addSID(strings.TrimPrefix(key, sidPrefix), time.Now().Add(ttl))
+		return nil
+	}); err != nil {
+		return err
+	}
+	return scan(userPrefix+"*", func(key string, ttl time.Duration) error {
+		id, err := strconv.ParseUint(strings.TrimPrefix(key, userPrefix), 10, 64)
+		if err != nil {
+			return nil
+		}
+		v, err := d.cache.Get(ctx, key).Int64()
+		if err != nil {
+			if errors.Is(err, redis.Nil) {
+				return nil
+			}
+			return err
+		}
+		d.addUser(uint(id), time.Unix(v, 0), time.Now().Add(ttl))
+		return nil
+	})
+}
+
+// IsRevoked reports whether the token described by claims has been revoked.
+// Redis errors fail open to the local store rather than locking everyone out.
+func (d *Denylist) IsRevoked(ctx context.Context, claims *Claims) bool {
+	var issued time.Time
+	if claims.IssuedAt != nil {
+		issued = claims.IssuedAt.Time
+	}
+
+	d.mu.Lock()
+	_, jtiRevoked := d.jtis[claims.ID]
+	_, sidRevoked := d.sids[claims.SessionID]
+	cut, userRevoked := d.users[claims.UserID]
+	d.mu.Unlock()
+	if jtiRevoked || (claims.SessionID != "" && sidRevoked) {
+		return true
+	}
+	if userRevoked && time.Now().Before(cut.expires) && issued.Before(cut.before) {
+		return true
+	}
+
+	if d.cache == nil || d.sub.Healthy() {
+		// the local store already mirrors Redis
+		return false
+	}
+	var keys []string
+	if claims.ID != "" {
+		keys = append(keys, jtiKey(claims.ID))
+	}
+	if claims.SessionID != "" {
+		keys = append(keys, sidKey(claims.SessionID))
+	}
+	if len(keys) > 0 {
+		n, err := d.cache.Exists(ctx, keys...).Result()
+		if err != nil {
+			log.Printf("denylist: redis exists: %v", err)
+			return false
+		}
+		if n > 0 {
+			return true
+		}
+	}
+	v, err := d.cache.Get(ctx, userKey(claims.UserID)).Result()
+	if err != nil {
+		if !errors.Is(err, redis.Nil) {
+			log.Printf("denylist: redis get: %v", err)
+		}
+		return false
+	}
+	before, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return false
+	}
+	return issued.Unix() < before
+}
+
+// pruneLocked drops expired local entries; callers must hold d.mu.
+func (d *Denylist) pruneLocked() {
+	now := time.Now()
+	for k, exp := range d.jtis {
+		if now.After(exp) {
+			delete(d.jtis, k)
+		}
+	}
+	for k, exp := range d.sids {
+		if now.After(exp) {
+			delete(d.sids, k)
+		}
+	}
+	for k, cut := range d.users {
+		if now.After(cut.expires) {
+			delete(d.users, k)
+		}
+	}
+}
@@ -1,218 +1,546 @@
 package auth
 
 import (
-    "crypto/rand"
-    "crypto/sha256"
-    "encoding/base64"
-    "encoding/hex"
-    "net/http"
-    "time"
-
-    "github.com/gin-gonic/gin"
-    "golang.org/x/crypto/bcrypt"
-
-    "github.com/temu-in/temu.in/booking-system-backend/internal/user"
-    "github.com/temu-in/temu.in/booking-system-backend/internal/models"
-    "github.com/temu-in/temu.in/booking-system-backend/internal/config"
-    "github.com/temu-in/temu.in/booking-system-backend/internal/token"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/temu-in/temu.in/booking-system-backend/internal/audit"
+	"github.com/temu-in/temu.in/booking-system-backend/internal/config"
+	"github.com/temu-in/temu.in/booking-system-backend/internal/mail"
+	"github.com/temu-in/temu.in/booking-system-backend/internal/models"
+	"github.com/temu-in/temu.in/booking-system-backend/internal/password"
+	"github.com/temu-in/temu.in/booking-system-backend/internal/token"
+	"github.com/temu-in/temu.in/booking-system-backend/internal/user"
 )
 
 type Handler struct {
-    repo    *user.Repository
-    config  *config.Config
-    tokens  *token.Repository
+	repo     *user.Repository
+	config   *config.Config
+	tokens   *token.Repository
+	keys     *Keyring
+	mailer   mail.Sender
+	audit    *audit.Repository
+	denylist *Denylist
+	limiter  *LoginLimiter
+	sessions *SessionPolicy
+	hasher   password.Hasher
+	policy   *password.Policy
+	passkeys *Passkeys
+	oidc     *OIDC
+
+	magicLimiter  *RequestLimiter
+	resetLimiter  *RequestLimiter
+	resendLimiter *RequestLimiter
+
+	// pending tracks work started by background, so Drain can wait for it
+	pending sync.WaitGroup
+
+	// dummyHash is verified against when there is no stored hash to check
+	dummyOnce sync.Once
+	dummyHash string
+}
+
+// backgroundTimeout bounds work a handler leaves running after its response.
+const backgroundTimeout = 30 * time.Second
+
+// background runs fn after the response has been written, detached from the
+// request's context.
+func (h *Handler) background(fn func(ctx context.Context)) {
+	h.pending.Add(1)
+	go func() {
+		defer h.pending.Done()
+		ctx, cancel := context.WithTimeout(context.Background(), backgroundTimeout)
+		defer cancel()
+		fn(ctx)
+	}()
+}
+
+// Drain waits for work started by background, such as emails queued by
+// ForgotPassword, to finish. It gives up when ctx is done and returns its
+// error; call it after the HTTP server has shut down.
+func (h *Handler) Drain(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		h.pending.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Option configures optional Handler dependencies.
+type Option func(*Handler)
+
+// WithMailer sets the sender used for transactional email (password reset,
+// email verification).
+func WithMailer(m mail.Sender) Option {
+	return func(h *Handler) { h.mailer = m }
+}
+
+// WithAuditLog persists security events (e.g. refresh-token reuse) in addition
+// to logging them.
+func WithAuditLog(a *audit.Repository) Option {
+	return func(h *Handler) { h.audit = a }
+}
+
+// WithDenylist lets Logout and password resets revoke outstanding access tokens.
+func WithDenylist(d *Denylist) Option {
+	return func(h *Handler) { h.denylist = d }
 }
 
-func NewHandler(repo *user.Repository, cfg *config.Config, tokens *token.Repository) *Handler {
-    return &Handler{repo: repo, config: cfg, tokens: tokens}
+// WithLoginLimiter enables brute-force protection on Login.
+func WithLoginLimiter(l *LoginLimiter) Option {
+	return func(h *Handler) { h.limiter = l }
 }
 
-func (h *Handler) RegisterRoutes(rg *gin.RouterGroup) {
-    rg.POST("/register", h.Register)
-    rg.POST("/login", h.Login)
-    rg.POST("/refresh", h.Refresh)
-    rg.POST("/logout", h.Logout)
+// WithPasswordHasher replaces the hasher built from the PASSWORD_ARGON2_*
+// settings.
+func WithPasswordHasher(p password.Hasher) Option {
+	return func(h *Handler) { h.hasher = p }
+}
+
+// WithPasswordPolicy sets the rules new passwords must satisfy.
+func WithPasswordPolicy(p *password.Policy) Option {
+	return func(h *Handler) { h.policy = p }
+}
+
+func NewHandler(repo *user.Repository, cfg *config.Config, tokens *token.Repository, keys *Keyring, opts ...Option) *Handler {
+	h := &Handler{repo: repo, config: cfg, tokens: tokens, keys: keys, mailer: mail.LogSender{}, sessions: NewSessionPolicy(cfg), hasher: password.FromConfig(cfg), policy: password.DefaultPolicy()}
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h
+}
+
+// RegisterRoutes mounts the auth API; requireAuth is the shared Middleware used
+// by the endpoints that need a logged-in user.
+func (h *Handler) RegisterRoutes(rg *gin.RouterGroup, requireAuth gin.HandlerFunc) {
+	rg.POST("/register", h.Register)
+	rg.POST("/login", h.Login)
+	rg.POST("/refresh", h.Refresh)
+	rg.POST("/logout", h.Logout)
+	rg.POST("/forgot-password", h.ForgotPassword)
+	rg.POST("/reset-password", h.ResetPassword)
+	rg.GET("/verify-email/:token", h.VerifyEmail)
+	rg.POST("/resend-verification", h.ResendVerification)
+	rg.POST("/2fa/verify", h.VerifyMFA)
+	rg.POST("/magic-link", h.RequestMagicLink)
+	rg.POST("/magic-link/verify", h.VerifyMagicLink)
+	// account management is off limits to API keys
+	rg.POST("/logout-all", requireAuth, RequireSession(), h.LogoutAll)
+	rg.POST("/change-password", requireAuth, RequireSession(), h.ChangePassword)
+	rg.POST("/impersonation/end", requireAuth, h.EndImpersonation)
+
+	if h.passkeys != nil {
+		rg.POST("/passkeys/login/begin", h.BeginPasskeyLogin)
+		rg.POST("/passkeys/login/finish", h.FinishPasskeyLogin)
+	}
+	if h.oidc != nil {
+		h.registerOIDCRoutes(rg)
+	}
+
+	mfa := rg.Group("/2fa", requireAuth, RequireSession())
+	mfa.POST("/setup", h.SetupTOTP)
+	mfa.POST("/enable", h.EnableTOTP)
+	mfa.POST("/disable", h.DisableTOTP)
+	mfa.POST("/recovery-codes", h.RegenerateRecoveryCodes)
 }
 
 type registerReq struct {
-    Email    string `json:"email" binding:"required,email"`
-    Password string `json:"password" binding:"required,min=6"`
-    Name     string `json:"name"`
+	Email    string `json:"email" binding:"required,email"`
+	Password string `json:"password" binding:"required"`
+	Name     string `json:"name"`
 }
 
 func (h *Handler) Register(c *gin.Context) {
-    var req registerReq
-    if err := c.ShouldBindJSON(&req); err != nil {
-        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-        return
-    }
-
-    existing, err := h.repo.FindByEmail(req.Email)
-    if err != nil {
-        c.JSON(http.StatusInternalServerError, gin.H{"error": "internal"})
-        return
-    }
-    if existing != nil {
-        c.JSON(http.StatusBadRequest, gin.H{"error": "email exists"})
-        return
-    }
-
-    pw, _ := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
-    user := &models.User{Email: req.Email, Password: string(pw), Name: req.Name, Role: "user"}
-    if err := h.repo.Create(user); err != nil {
-        c.JSON(http.StatusInternalServerError, gin.H{"error": "create failed"})
-        return
-    }
-
-    token, err := NewToken(h.config.JWTSecret, user.ID, user.Role, h.config.AccessTokenTTL)
-    if err != nil {
-        c.JSON(http.StatusInternalServerError, gin.H{"error": "token"})
-        return
-    }
-
-        // create refresh token (secure random)
-        rt, err := generateSecureToken(32)
-        if err == nil {
-            hash := hashToken(rt)
-            r := &models.RefreshToken{TokenHash: hash, UserID: user.ID, ExpiresAt: time.Now().Add(24 * time.Hour)}
-            _ = h.tokens.Create(r)
-            cookie := &http.Cookie{Name: "refresh_token", Value: rt, HttpOnly: true, Path: "/", Expires: r.ExpiresAt}
-            // security: only secure in production
-            if h.config.AppEnv == "production" {
-                cookie.Secure = true
-                cookie.SameSite = http.SameSiteStrictMode
-            } else {
-                cookie.SameSite = http.SameSiteLaxMode
-            }
-            http.SetCookie(c.Writer, cookie)
-        }
-
-    c.JSON(http.StatusOK, gin.H{"token": token, "user": gin.H{"id": user.ID, "email": user.Email, "role": user.Role}})
+	var req registerReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	existing, err := h.repo.FindByEmail(req.Email)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal"})
+		return
+	}
+	if existing != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "email exists"})
+		return
+	}
+	if !h.acceptablePassword(c, req.Password, &models.User{Email: req.Email, Name: req.Name}) {
+		return
+	}
+
+	pw, err := h.hasher.Hash(req.Password)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal"})
+		return
+	}
+	user := &models.User{Email: req.Email, Password: pw, Name: req.Name, Role: models.RoleCustomer, SecurityVersion: 1}
+	if err := h.repo.Create(user); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "create failed"})
+		return
+	}
+
+	if err := h.sendVerification(c.Request.Context(), user); err != nil {
+		log.Printf("email verification for user %d: %v", user.ID, err)
+	}
+	if h.config.UnverifiedPolicy == config.UnverifiedBlockLogin {
+		// no session until the address is confirmed
+		c.JSON(http.StatusOK, gin.H{"verification_required": true, "user": gin.H{"id": user.ID, "email": user.Email, "role": user.Role, "is_verified": user.IsVerified}})
+		return
+	}
+
+	h.startSession(c, user, false, AMRPassword)
 }
 
 type loginReq struct {
-    Email    string `json:"email" binding:"required,email"`
-    Password string `json:"password" binding:"required"`
+	Email    string `json:"email" binding:"required,email"`
+	Password string `json:"password" binding:"required"`
+	// RememberMe asks for a persistent cookie and the longer session lifetime.
+	RememberMe bool `json:"remember_me"`
 }
 
 func (h *Handler) Login(c *gin.Context) {
-    var req loginReq
-    if err := c.ShouldBindJSON(&req); err != nil {
-        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-        return
-    }
-
-    u, err := h.repo.FindByEmail(req.Email)
-    if err != nil {
-        c.JSON(http.StatusInternalServerError, gin.H{"error": "internal"})
-        return
-    }
-    if u == nil {
-        c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid credentials"})
-        return
-    }
-
-    if err := bcrypt.CompareHashAndPassword([]byte(u.Password), []byte(req.Password)); err != nil {
-        c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid credentials"})
-        return
-    }
-
-    token, err := NewToken(h.config.JWTSecret, u.ID, u.Role, h.config.AccessTokenTTL)
-    if err != nil {
-        c.JSON(http.StatusInternalServerError, gin.H{"error": "token"})
-        return
-    }
-
-        // create refresh token (secure random)
-        rt, err := generateSecureToken(32)
-        if err == nil {
-            hash := hashToken(rt)
-            r := &models.RefreshToken{TokenHash: hash, UserID: u.ID, ExpiresAt: time.Now().Add(24 * time.Hour)}
-            _ = h.tokens.Create(r)
-            cookie := &http.Cookie{Name: "refresh_token", Value: rt, HttpOnly: true, Path: "/", Expires: r.ExpiresAt}
-            if h.config.AppEnv == "production" {
-                cookie.Secure = true
-                cookie.SameSite = http.SameSiteStrictMode
-            } else {
-                cookie.SameSite = http.SameSiteLaxMode
-            }
-            http.SetCookie(c.Writer, cookie)
-        }
-
-    c.JSON(http.StatusOK, gin.H{"token": token, "user": gin.H{"id": u.ID, "email": u.Email, "role": u.Role}})
+	var req loginReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if h.limiter != nil {
+		if wait := h.limiter.Blocked(c.Request.Context(), req.Email, c.ClientIP()); wait > 0 {
+			tooManyAttempts(c, wait)
+			return
+		}
+	}
+
+	u, err := h.repo.FindByEmail(req.Email)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal"})
+		return
+	}
+	if u == nil {
+		h.verifyDummy(req.Password)
+		h.loginFailed(c, req.Email, 0)
+		return
+	}
+	if u.Password == "" {
+		// signs in through a provider or magic link only
+		h.verifyDummy(req.Password)
+		h.loginFailed(c, req.Email, u.ID)
+		return
+	}
+
+	match, err := h.hasher.Verify(req.Password, u.Password)
+	if err != nil {
+		log.Printf("verify password for user %d: %v", u.ID, err)
+	}
+	if !match {
+		h.loginFailed(c, req.Email, u.ID)
+		return
+	}
+	h.upgradeHash(u, req.Password)
+	if h.limiter != nil {
+		_ = h.limiter.Reset(c.Request.Context(), req.Email)
+	}
+	if u.Suspended(time.Now()) {
+		accountSuspended(c, u)
+		return
+	}
+
+	if !u.IsVerified && h.config.UnverifiedPolicy == config.UnverifiedBlockLogin {
+		c.JSON(http.StatusForbidden, gin.H{"error": "email not verified"})
+		return
+	}
+
+	if u.TOTPEnabled {
+		h.mfaChallenge(c, u, AMRPassword)
+		return
+	}
+
+	h.startSession(c, u, req.RememberMe, AMRPassword)
 }
 
 func (h *Handler) Refresh(c *gin.Context) {
-    cookie, err := c.Request.Cookie("refresh_token")
-    if err != nil {
-        c.JSON(http.StatusUnauthorized, gin.H{"error": "missing refresh"})
-        return
-    }
-    oldHash := hashToken(cookie.Value)
-    rtRec, err := h.tokens.FindByHash(oldHash)
-    if err != nil || rtRec == nil || rtRec.Revoked || rtRec.ExpiresAt.Before(time.Now()) {
-        c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid refresh"})
-        return
-    }
-
-    u, err := h.repo.FindByID(rtRec.UserID)
-    if err != nil || u == nil {
-        c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid refresh"})
-        return
-    }
-
-    // rotate: create new refresh token, store it, revoke old
-    newRT, genErr := generateSecureToken(32)
-    if genErr != nil {
-        c.JSON(http.StatusInternalServerError, gin.H{"error": "refresh"})
-        return
-    }
-    newHash := hashToken(newRT)
-    newRec := &models.RefreshToken{TokenHash: newHash, UserID: u.ID, ExpiresAt: time.Now().Add(24 * time.Hour)}
-    if err := h.tokens.Create(newRec); err != nil {
-        c.JSON(http.StatusInternalServerError, gin.H{"error": "refresh"})
-        return
-    }
-    _ = h.tokens.RevokeByHash(oldHash)
-
-    // set cookie for new refresh token
-    cookieOut := &http.Cookie{Name: "refresh_token", Value: newRT, HttpOnly: true, Path: "/", Expires: newRec.ExpiresAt}
-    if h.config.AppEnv == "production" {
-        cookieOut.Secure = true
-        cookieOut.SameSite = http.SameSiteStrictMode
-    } else {
-        cookieOut.SameSite = http.SameSiteLaxMode
-    }
-    http.SetCookie(c.Writer, cookieOut)
-
-    token, err := NewToken(h.config.JWTSecret, u.ID, u.Role, h.config.AccessTokenTTL)
-    if err != nil {
-        c.JSON(http.StatusInternalServerError, gin.H{"error": "token"})
-        return
-    }
-    c.JSON(http.StatusOK, gin.H{"token": token})
+	cookie, err := c.Request.Cookie(RefreshCookieName)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "missing refresh"})
+		return
+	}
+	oldHash := hashToken(cookie.Value)
+	rtRec, err := h.tokens.FindByHash(oldHash)
+	if err != nil || rtRec == nil || rtRec.Revoked {
+		h.rejectRefresh(c, oldHash)
+		return
+	}
+	now := time.Now()
+	if !h.sessions.Valid(rtRec, now) {
+		// idle or past its absolute lifetime; the session is over for good
+		_ = h.tokens.RevokeByHash(oldHash)
+		h.sessions.ClearCookie(c)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid refresh"})
+		return
+	}
+
+	u, err := h.repo.FindByID(rtRec.UserID)
+	if err != nil || u == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid refresh"})
+		return
+	}
+	if u.Suspended(now) {
+		_ = h.tokens.RevokeAllForUser(u.ID)
+		h.sessions.ClearCookie(c)
+		accountSuspended(c, u)
+		return
+	}
+
+	// rotate: create new refresh token, store it, revoke old
+	newRT, genErr := generateSecureToken(32)
+	if genErr != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "refresh"})
+		return
+	}
+	newHash := hashToken(newRT)
+	family := rtRec.FamilyID
+	if family == "" {
+		// tokens issued before families existed start a new lineage
+		family = newFamilyID()
+	}
+	startedAt := rtRec.StartedAt
+	if startedAt.IsZero() {
+		startedAt = rtRec.CreatedAt
+	}
+	newRec := &models.RefreshToken{
+		TokenHash: newHash, UserID: u.ID, FamilyID: family, AMR: rtRec.AMR, RememberMe: rtRec.RememberMe,
+		StartedAt: startedAt, LastUsedAt: now, UserAgent: c.Request.UserAgent(), IP: c.ClientIP(),
+		ExpiresAt: h.sessions.Expiry(startedAt, now, rtRec.RememberMe),
+	}
+	if err := h.tokens.Rotate(oldHash, newRec); err != nil {
+		if errors.Is(err, token.ErrTokenReused) {
+			h.rejectRefresh(c, oldHash)
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "refresh"})
+		return
+	}
+
+	// set cookie for new refresh token
+	h.sessions.SetCookie(c, newRT, newRec)
+
+	token, err := NewToken(h.keys, &Claims{UserID: u.ID, Role: u.Role, AMR: strings.Fields(rtRec.AMR), SessionID: family, Version: u.SecurityVersion, Verified: u.IsVerified}, h.config.AccessTokenTTL)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "token"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"token": token})
 }
 
 func (h *Handler) Logout(c *gin.Context) {
-    cookie, err := c.Request.Cookie("refresh_token")
-    if err == nil {
-        hash := hashToken(cookie.Value)
-        _ = h.tokens.RevokeByHash(hash)
-        // clear cookie
-        http.SetCookie(c.Writer, &http.Cookie{Name: "refresh_token", Value: "", Path: "/", Expires: time.Unix(0, 0)})
-    }
-    c.JSON(http.StatusOK, gin.H{"status": "logged_out"})
+	cookie, err := c.Request.Cookie(RefreshCookieName)
+	if err == nil {
+		hash := hashToken(cookie.Value)
+		_ = h.tokens.RevokeByHash(hash)
+		// clear cookie
+		h.sessions.ClearCookie(c)
+	}
+	// also kill the access token the client is holding, if it sent one
+	if raw, ok := bearerToken(c); ok && h.denylist != nil {
+		if claims, err := ParseToken(h.keys, raw); err == nil && claims.ExpiresAt != nil {
+			h.denylist.Revoke(c.Request.Context(), claims.ID, claims.ExpiresAt.Time)
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "logged_out"})
+}
+
+// upgradeHash re-hashes a just-verified password when the stored hash uses an
+// old algorithm or weaker parameters. Failures only delay the upgrade.
+// verifyDummy takes as long as checking a real password, so that a login for
+// an unknown address, or an account without a password, cannot be told apart
+// by its response time.
+func (h *Handler) verifyDummy(plain string) {
+	h.dummyOnce.Do(func() {
+		var err error
+		if h.dummyHash, err = h.hasher.Hash("not-a-real-password"); err != nil {
+			log.Printf("dummy password hash: %v", err)
+		}
+	})
+	if h.dummyHash != "" {
+		_, _ = h.hasher.Verify(plain, h.dummyHash)
+	}
+}
+
+func (h *Handler) upgradeHash(u *models.User, plain string) {
+	if !h.hasher.NeedsRehash(u.Password) {
+		return
+	}
+	pw, err := h.hasher.Hash(plain)
+	if err != nil {
+		log.Printf("rehash password for user %d: %v", u.ID, err)
+		return
+	}
+	if err := h.repo.RehashPassword(u.ID, pw); err != nil {
+		log.Printf("store rehashed password for user %d: %v", u.ID, err)
+		return
+	}
+	u.Password = pw
+}
+
+// startSession logs the user in and writes the login response.
+func (h *Handler) startSession(c *gin.Context, u *models.User, rememberMe bool, amr ...string) {
+	token, err := h.issueSession(c, u, rememberMe, amr...)
+	if errors.Is(err, ErrAccountSuspended) {
+		accountSuspended(c, u)
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "token"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"token": token, "user": gin.H{"id": u.ID, "email": u.Email, "role": u.Role, "is_verified": u.IsVerified}})
+}
+
+// issueSession returns a new access token and sets a refresh cookie starting a
+// new token family. amr lists the authentication methods used and, like
+// rememberMe, is carried over on every rotation.
+func (h *Handler) issueSession(c *gin.Context, u *models.User, rememberMe bool, amr ...string) (string, error) {
+	if u.Suspended(time.Now()) {
+		return "", ErrAccountSuspended
+	}
+	family := newFamilyID()
+	token, err := NewToken(h.keys, &Claims{UserID: u.ID, Role: u.Role, AMR: amr, SessionID: family, Version: u.SecurityVersion, Verified: u.IsVerified}, h.config.AccessTokenTTL)
+	if err != nil {
+		return "", err
+	}
+
+	// create refresh token (secure random)
+	rt, err := generateSecureToken(32)
+	if err == nil {
+		hash := hashToken(rt)
+		now := time.Now()
+		r := &models.RefreshToken{
+			TokenHash: hash, UserID: u.ID, FamilyID: family, AMR: strings.Join(amr, " "), RememberMe: rememberMe,
+			StartedAt: now, LastUsedAt: now, UserAgent: c.Request.UserAgent(), IP: c.ClientIP(),
+			ExpiresAt: h.sessions.Expiry(now, now, rememberMe),
+		}
+		_ = h.tokens.Create(r)
+		h.sessions.SetCookie(c, rt, r)
+	}
+
+	return token, nil
+}
+
+// ErrAccountSuspended is returned by issueSession for suspended users.
+var ErrAccountSuspended = errors.New("account suspended")
+
+// accountSuspended writes the response refusing a suspended user a session.
+func accountSuspended(c *gin.Context, u *models.User) {
+	c.JSON(http.StatusForbidden, gin.H{"error": "account suspended", "suspended_until": u.SuspendedUntil})
+}
+
+// rotationGrace is how long after a rotation the old refresh token may still
+// be presented without counting as reuse: tabs sharing the cookie refresh
+// concurrently, and all but one of them lose the race.
+const rotationGrace = 5 * time.Second
+
+// rejectRefresh answers a refresh with a token that is no longer valid.
+func (h *Handler) rejectRefresh(c *gin.Context, hash string) {
+	if h.detectReuse(c, hash) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid refresh"})
+		return
+	}
+	// the cookie already holds the new token; the client may retry
+	c.JSON(http.StatusConflict, gin.H{"error": "refresh token already rotated"})
+}
+
+// detectReuse handles a refresh token that is no longer valid and reports
+// whether it counts as reuse. If it was revoked by rotation it is being
+// replayed, which means either the client or an attacker holds a stale copy;
+// the whole family and its access tokens are revoked so neither branch can
+// keep going. A token rotated within rotationGrace is let off.
+func (h *Handler) detectReuse(c *gin.Context, hash string) bool {
+	rec, err := h.tokens.FindRotatedByHash(hash)
+	if err != nil || rec == nil || rec.FamilyID == "" {
+		return true
+	}
+	if rec.RotatedAt != nil && time.Since(*rec.RotatedAt) < rotationGrace {
+		return false
+	}
+	if err := h.tokens.RevokeFamily(rec.FamilyID); err != nil {
+		log.Printf("revoke token family %s: %v", rec.FamilyID, err)
+	}
+	if h.denylist != nil {
+		h.denylist.RevokeSession(c.Request.Context(), rec.FamilyID)
+	}
+	h.securityEvent(c, EventRefreshTokenReuse, rec.UserID, "family="+rec.FamilyID+" revoked")
+	return true
+}
+
+func newFamilyID() string {
+	id, err := generateSecureToken(16)
+	if err != nil {
+		// fall back to a time-based id; uniqueness matters more than secrecy here
+		return fmt.Sprintf("f%d", time.Now().UnixNano())
+	}
+	return id
+}
+
+// issueActionToken creates a single-use token for the given purpose and returns
+// the raw value to embed in a link. Older unused tokens of the same purpose are
+// invalidated so only the newest link works.
+func (h *Handler) issueActionToken(userID uint, purpose string, ttl time.Duration) (string, error) {
+	return h.issueBoundActionToken(userID, purpose, ttl, "")
+}
+
+// issueBoundActionToken is issueActionToken for a token that may only be
+// consumed together with the nonce whose hash is bindingHash.
+func (h *Handler) issueBoundActionToken(userID uint, purpose string, ttl time.Duration, bindingHash string) (string, error) {
+	return h.storeActionToken(&models.ActionToken{UserID: userID, Purpose: purpose, ExpiresAt: time.Now().Add(ttl), BindingHash: bindingHash})
+}
+
+// storeActionToken generates the token for rec, replacing any earlier token
+// of the user for the same purpose.
+func (h *Handler) storeActionToken(rec *models.ActionToken) (string, error) {
+	raw, err := generateSecureToken(32)
+	if err != nil {
+		return "", fmt.Errorf("generate token: %w", err)
+	}
+	if err := h.tokens.InvalidateActions(rec.UserID, rec.Purpose); err != nil {
+		return "", fmt.Errorf("invalidate previous tokens: %w", err)
+	}
+	rec.TokenHash = hashToken(raw)
+	if err := h.tokens.CreateAction(rec); err != nil {
+		return "", fmt.Errorf("store token: %w", err)
+	}
+	return raw, nil
 }
 
 func generateSecureToken(n int) (string, error) {
-    b := make([]byte, n)
-    if _, err := rand.Read(b); err != nil {
-        return "", err
-    }
-    return base64.RawURLEncoding.EncodeToString(b), nil
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
 }
 
 func hashToken(t string) string {
-    h := sha256.Sum256([]byte(t))
-    return hex.EncodeToString(h[:])
+	h := sha256.Sum256([]byte(t))
+	return hex.EncodeToString(h[:])
 }
@@ -0,0 +1,153 @@
+package auth
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/caarlos0/env/v11"
+	"github.com/gin-gonic/gin"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"github.com/temu-in/temu.in/booking-system-backend/internal/config"
+	"github.com/temu-in/temu.in/booking-system-backend/internal/mail"
+	"github.com/temu-in/temu.in/booking-system-backend/internal/models"
+	"github.com/temu-in/temu.in/booking-system-backend/internal/token"
+	"github.com/temu-in/temu.in/booking-system-backend/internal/user"
+)
+
+func init() { gin.SetMode(gin.TestMode) }
+
+// testConfig returns the default configuration with cheap password hashing.
+func testConfig(t *testing.T) *config.Config {
+	t.Helper()
+	cfg := &config.Config{}
+	err := env.ParseWithOptions(cfg, env.Options{Environment: map[string]string{
+		"APP_ENV":                     "test",
+		"DATABASE_URL":                "sqlite://memory",
+		"REDIS_URL":                   "redis://unused",
+		"JWT_SECRET":                  "test-secret",
+		"PASSWORD_ARGON2_MEMORY":      "64",
+		"PASSWORD_ARGON2_ITERATIONS":  "1",
+		"PASSWORD_ARGON2_PARALLELISM": "1",
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cfg
+}
+
+// testDB opens a private in-memory database with the auth tables.
+func testDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// every connection to :memory: is a new database
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+	if err := db.AutoMigrate(&models.User{}, &models.RefreshToken{}, &models.ActionToken{}, &models.SecurityEvent{}, &models.RecoveryCode{}, &models.APIKey{}, &models.Passkey{}, &models.Identity{}); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// testEnv is a Handler wired to an in-memory database and outbox, with its
+// routes mounted under /auth.
+type testEnv struct {
+	cfg    *config.Config
+	db     *gorm.DB
+	users  *user.Repository
+	tokens *token.Repository
+	keys   *Keyring
+	outbox *mail.Outbox
+	h      *Handler
+	router *gin.Engine
+}
+
+func newTestEnv(t *testing.T, cfg *config.Config, opts ...Option) *testEnv {
+	t.Helper()
+	if cfg == nil {
+		cfg = testConfig(t)
+	}
+	e := &testEnv{cfg: cfg, db: testDB(t), outbox: mail.NewOutbox()}
+	e.users = user.NewRepository(e.db)
+	e.tokens = token.NewRepository(e.db)
+	keys, err := KeyringFromConfig(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.keys = keys
+	opts = append([]Option{WithMailer(e.outbox)}, opts...)
+	e.h = NewHandler(e.users, cfg, e.tokens, keys, opts...)
+	t.Cleanup(e.h.pending.Wait)
+
+	e.router = gin.New()
+	e.h.RegisterRoutes(e.router.Group("/auth"), Middleware(keys))
+	return e
+}
+
+// createUser stores a verified customer with the given password.
+func (e *testEnv) createUser(t *testing.T, email, pw string) *models.User {
+	t.Helper()
+	hash, err := e.h.hasher.Hash(pw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u := &models.User{Email: email, Password: hash, Role: models.RoleCustomer, IsVerified: true}
+	if err := e.users.Create(u); err != nil {
+		t.Fatal(err)
+	}
+	return u
+}
+
+// do sends body as JSON and returns the recorded response.
+func (e *testEnv) do(t *testing.T, method, path string, body interface{}, header ...string) *httptest.ResponseRecorder {
+	t.Helper()
+	var buf bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&buf).Encode(body); err != nil {
+			t.Fatal(err)
+		}
+	}
+	req := httptest.NewRequest(method, path, &buf)
+	req.Header.Set("Content-Type", "application/json")
+	for i := 0; i+1 < len(header); i += 2 {
+		req.Header.Set(header[i], header[i+1])
+	}
+	w := httptest.NewRecorder()
+	e.router.ServeHTTP(w, req)
+	return w
+}
+
+// decode unmarshals a JSON response body.
+func decode(t *testing.T, w *httptest.ResponseRecorder) map[string]interface{} {
+	t.Helper()
+	var out map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &out); err != nil {
+		t.Fatalf("decode %q: %v", w.Body.String(), err)
+	}
+	return out
+}
+
+func wantStatus(t *testing.T, w *httptest.ResponseRecorder, code int) {
+	t.Helper()
+	if w.Code != code {
+		t.Fatalf("status = %d, want %d; body %s", w.Code, code, w.Body.String())
+	}
+}
+
+// bearer returns an Authorization header pair for a session access token of u.
+func (e *testEnv) bearer(t *testing.T, u *models.User) []string {
+	t.Helper()
+	tok, err := NewToken(e.keys, &Claims{UserID: u.ID, Role: u.Role, AMR: []string{AMRPassword}, SessionID: newFamilyID(), Version: u.SecurityVersion, Verified: u.IsVerified}, e.cfg.AccessTokenTTL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return []string{"Authorization", "Bearer " + tok}
+}
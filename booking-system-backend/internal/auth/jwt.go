@@ -1,40 +1,78 @@
 package auth
 
 import (
-    "time"
+	"time"
 
-    "github.com/golang-jwt/jwt/v4"
+	"github.com/golang-jwt/jwt/v4"
+
+	"github.com/temu-in/temu.in/booking-system-backend/internal/models"
 )
 
 type Claims struct {
-    UserID uint   `json:"user_id"`
-    Role   string `json:"role"`
-    jwt.RegisteredClaims
+	UserID uint        `json:"user_id"`
+	Role   models.Role `json:"role"`
+	// AMR lists the authentication methods behind the session (RFC 8176),
+	// e.g. ["pwd", "otp"].
+	AMR []string `json:"amr,omitempty"`
+	// SessionID is the refresh-token family the access token was minted from,
+	// so revoking a session can also cut off its access tokens.
+	SessionID string `json:"sid,omitempty"`
+	// Version is the user's security version when the token was issued; see
+	// CheckSecurityVersion.
+	Version uint `json:"ver,omitempty"`
+	// Verified records that the user's email was verified when the token was
+	// issued, so RequireVerified need not look the user up.
+	Verified bool `json:"email_verified,omitempty"`
+	// Act is set on impersonation tokens and names the staff member really
+	// making the requests.
+	Act *Actor `json:"act,omitempty"`
+	// Scopes and APIKeyID are only set for API-key principals (see
+	// AcceptAPIKeys); they never appear in a signed token.
+	Scopes   []string `json:"-"`
+	APIKeyID uint     `json:"-"`
+	jwt.RegisteredClaims
+}
+
+// Authentication method references used in the amr claim.
+const (
+	AMRPassword = "pwd"
+	AMROTP      = "otp"
+	// AMRPasskey marks a WebAuthn login; passkeys require user verification,
+	// so those sessions also carry AMRMFA.
+	AMRPasskey = "hwk"
+	AMRMFA     = "mfa"
+	// AMREmail marks a magic-link login; RFC 8176 has no value for it.
+	AMREmail = "email"
+	// AMRFederated marks a login through an external OpenID Connect provider.
+	AMRFederated = "fed"
+)
+
+// NewToken signs an access token for the given claims with the keyring's
+// primary key. The token ID, issue time and expiry are filled in here.
+func NewToken(keys *Keyring, claims *Claims, ttl time.Duration) (string, error) {
+	// jti lets a single token be denylisted on logout
+	jti, err := generateSecureToken(16)
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
+	claims.ID = jti
+	claims.IssuedAt = jwt.NewNumericDate(now)
+	claims.ExpiresAt = jwt.NewNumericDate(now.Add(ttl))
+	return keys.Sign(claims)
 }
 
-func NewToken(secret string, userID uint, role string, ttl time.Duration) (string, error) {
-    claims := &Claims{
-        UserID: userID,
-        Role:   role,
-        RegisteredClaims: jwt.RegisteredClaims{
-            ExpiresAt: jwt.NewNumericDate(time.Now().Add(ttl)),
-            IssuedAt:  jwt.NewNumericDate(time.Now()),
-        },
-    }
-
-    token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-    return token.SignedString([]byte(secret))
+// HasAMR reports whether the session was authenticated with the given method.
+func (c *Claims) HasAMR(method string) bool {
+	for _, m := range c.AMR {
+		if m == method {
+			return true
+		}
+	}
+	return false
 }
 
-func ParseToken(secret, tokenStr string) (*Claims, error) {
-    token, err := jwt.ParseWithClaims(tokenStr, &Claims{}, func(token *jwt.Token) (interface{}, error) {
-        return []byte(secret), nil
-    })
-    if err != nil {
-        return nil, err
-    }
-    if claims, ok := token.Claims.(*Claims); ok && token.Valid {
-        return claims, nil
-    }
-    return nil, jwt.ErrTokenInvalidClaims
+// ParseToken verifies an access token against the keyring.
+func ParseToken(keys *Keyring, tokenStr string) (*Claims, error) {
+	return keys.Parse(tokenStr)
 }
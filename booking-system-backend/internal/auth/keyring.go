@@ -0,0 +1,334 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v4"
+
+	"github.com/temu-in/temu.in/booking-system-backend/internal/config"
+)
+
+// Supported signing algorithms.
+const (
+	AlgHS256 = "HS256"
+	AlgRS256 = "RS256"
+	AlgEdDSA = "EdDSA"
+)
+
+// Key is one entry of a Keyring. Asymmetric keys without a private half can
+// still verify tokens, which is how a retired key is kept around.
+type Key struct {
+	ID        string
+	Algorithm string
+	RetiredAt time.Time // zero while the key is active
+
+	sign   interface{} // []byte, *rsa.PrivateKey or ed25519.PrivateKey
+	verify interface{} // []byte, *rsa.PublicKey or ed25519.PublicKey
+}
+
+func (k *Key) method() jwt.SigningMethod {
+	return jwt.GetSigningMethod(k.Algorithm)
+}
+
+// Keyring signs access tokens with its primary key and verifies tokens from
+// any key that is active or still inside its post-retirement grace period.
+type Keyring struct {
+	primary  *Key
+	keys     map[string]*Key
+	grace    time.Duration
+	issuer   string
+	audience string
+}
+
+var (
+	errUnknownKey    = errors.New("unknown signing key")
+	errKeyExpired    = errors.New("signing key retired")
+	errWrongAlg      = errors.New("unexpected signing algorithm")
+	errWrongIssuer   = errors.New("invalid issuer")
+	errWrongAudience = errors.New("invalid audience")
+)
+
+// NewKeyring builds a keyring. primary must have a private (or shared) key;
+// others are accepted for verification only.
+func NewKeyring(issuer, audience string, grace time.Duration, primary *Key, others ...*Key) (*Keyring, error) {
+	if primary == nil || primary.sign == nil {
+		return nil, errors.New("keyring: primary key cannot sign")
+	}
+	kr := &Keyring{primary: primary, keys: map[string]*Key{}, grace: grace, issuer: issuer, audience: audience}
+	for _, k := range append([]*Key{primary}, others...) {
+		if k.method() == nil {
+			return nil, fmt.Errorf("keyring: key %s: unsupported algorithm %q", k.ID, k.Algorithm)
+		}
+		if _, dup := kr.keys[k.ID]; dup {
+			return nil, fmt.Errorf("keyring: duplicate kid %q", k.ID)
+		}
+		kr.keys[k.ID] = k
+	}
+	return kr, nil
+}
+
+// NewHMACKey returns an HS256 key for a shared secret.
+func NewHMACKey(kid, secret string) *Key {
+	return &Key{ID: kid, Algorithm: AlgHS256, sign: []byte(secret), verify: []byte(secret)}
+}
+
+// NewRSAKey returns an RS256 key. Pass a nil private key for verify-only.
+func NewRSAKey(kid string, priv *rsa.PrivateKey, pub *rsa.PublicKey) *Key {
+	k := &Key{ID: kid, Algorithm: AlgRS256, verify: pub}
+	if priv != nil {
+		k.sign = priv
+		k.verify = &priv.PublicKey
+	}
+	return k
+}
+
+// NewEd25519Key returns an EdDSA key. Pass a nil private key for verify-only.
+func NewEd25519Key(kid string, priv ed25519.PrivateKey, pub ed25519.PublicKey) *Key {
+	k := &Key{ID: kid, Algorithm: AlgEdDSA, verify: pub}
+	if priv != nil {
+		k.sign = priv
+		k.verify = priv.Public().(ed25519.PublicKey)
+	}
+	return k
+}
+
+// Sign signs claims with the primary key, stamping issuer and audience.
+func (kr *Keyring) Sign(claims *Claims) (string, error) {
+	claims.Issuer = kr.issuer
+	claims.Audience = jwt.ClaimStrings{kr.audience}
+	t := jwt.NewWithClaims(kr.primary.method(), claims)
+	t.Header["kid"] = kr.primary.ID
+	return t.SignedString(kr.primary.sign)
+}
+
+// Parse verifies a token's signature, algorithm, expiry, issuer and audience.
+func (kr *Keyring) Parse(tokenStr string) (*Claims, error) {
+	token, err := jwt.ParseWithClaims(tokenStr, &Claims{}, kr.keyFunc)
+	if err != nil {
+		return nil, err
+	}
+	claims, ok := token.Claims.(*Claims)
+	if !ok || !token.Valid {
+		return nil, jwt.ErrTokenInvalidClaims
+	}
+	if !claims.VerifyIssuer(kr.issuer, true) {
+		return nil, errWrongIssuer
+	}
+	if !claims.VerifyAudience(kr.audience, true) {
+		return nil, errWrongAudience
+	}
+	return claims, nil
+}
+
+func (kr *Keyring) keyFunc(t *jwt.Token) (interface{}, error) {
+	kid, _ := t.Header["kid"].(string)
+	key := kr.keys[kid]
+	if key == nil {
+		return nil, errUnknownKey
+	}
+	// the algorithm comes from our key, never from the token header
+	if t.Method.Alg() != key.Algorithm {
+		return nil, errWrongAlg
+	}
+	if !key.RetiredAt.IsZero() && time.Now().After(key.RetiredAt.Add(kr.grace)) {
+		return nil, errKeyExpired
+	}
+	return key.verify, nil
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+// JWKS returns the public keys that can currently verify tokens. Shared HMAC
+// secrets are never published.
+func (kr *Keyring) JWKS() map[string][]jwk {
+	keys := []jwk{}
+	now := time.Now()
+	for _, k := range kr.keys {
+		if !k.RetiredAt.IsZero() && now.After(k.RetiredAt.Add(kr.grace)) {
+			continue
+		}
+		switch pub := k.verify.(type) {
+		case *rsa.PublicKey:
+			keys = append(keys, jwk{
+				Kty: "RSA", Use: "sig", Alg: k.Algorithm, Kid: k.ID,
+				N: base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+				E: base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+			})
+		case ed25519.PublicKey:
+			keys = append(keys, jwk{
+				Kty: "OKP", Use: "sig", Alg: k.Algorithm, Kid: k.ID,
+				Crv: "Ed25519", X: base64.RawURLEncoding.EncodeToString(pub),
+			})
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].Kid < keys[j].Kid })
+	return map[string][]jwk{"keys": keys}
+}
+
+// JWKSHandler serves the keyring at /.well-known/jwks.json.
+func JWKSHandler(kr *Keyring) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("Cache-Control", "public, max-age=300")
+		c.JSON(http.StatusOK, kr.JWKS())
+	}
+}
+
+// KeyringFromConfig loads JWT_KEYS_FILE when set and otherwise falls back to a
+// single HS256 key derived from JWT_SECRET.
+func KeyringFromConfig(cfg *config.Config) (*Keyring, error) {
+	if cfg.JWTKeysFile != "" {
+		return LoadKeyring(cfg.JWTKeysFile, cfg.JWTIssuer, cfg.JWTAudience, cfg.JWTKeyGrace)
+	}
+	return NewKeyring(cfg.JWTIssuer, cfg.JWTAudience, cfg.JWTKeyGrace, NewHMACKey("hs-default", cfg.JWTSecret))
+}
+
+// keyFileEntry is one key in the JSON file referenced by JWT_KEYS_FILE.
+type keyFileEntry struct {
+	Kid            string    `json:"kid"`
+	Alg            string    `json:"alg"`
+	PrivateKeyFile string    `json:"private_key_file"`
+	PublicKeyFile  string    `json:"public_key_file"`
+	Secret         string    `json:"secret"`
+	RetiredAt      time.Time `json:"retired_at"`
+}
+
+type keyFile struct {
+	Primary string         `json:"primary"`
+	Keys    []keyFileEntry `json:"keys"`
+}
+
+// LoadKeyring reads a key file of the form
+//
+//	{"primary": "2026-10", "keys": [
+//	  {"kid": "2026-10", "alg": "EdDSA", "private_key_file": "/keys/ed25519.pem"},
+//	  {"kid": "2026-04", "alg": "RS256", "public_key_file": "/keys/rsa.pub.pem", "retired_at": "2026-10-01T00:00:00Z"}
+//	]}
+//
+// PEM files hold PKCS#8/PKCS#1 private keys or PKIX public keys.
+func LoadKeyring(path, issuer, audience string, grace time.Duration) (*Keyring, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read key file: %w", err)
+	}
+	var kf keyFile
+	if err := json.Unmarshal(raw, &kf); err != nil {
+		return nil, fmt.Errorf("parse key file: %w", err)
+	}
+
+	var primary *Key
+	var others []*Key
+	for _, e := range kf.Keys {
+		k, err := loadKey(e)
+		if err != nil {
+			return nil, fmt.Errorf("key %s: %w", e.Kid, err)
+		}
+		if e.Kid == kf.Primary {
+			primary = k
+		} else {
+			others = append(others, k)
+		}
+	}
+	if primary == nil {
+		return nil, fmt.Errorf("primary key %q not found", kf.Primary)
+	}
+	if !primary.RetiredAt.IsZero() {
+		return nil, fmt.Errorf("primary key %q is retired", kf.Primary)
+	}
+	return NewKeyring(issuer, audience, grace, primary, others...)
+}
+
+func loadKey(e keyFileEntry) (*Key, error) {
+	var k *Key
+	switch e.Alg {
+	case AlgHS256:
+		if e.Secret == "" {
+			return nil, errors.New("HS256 key needs a secret")
+		}
+		k = NewHMACKey(e.Kid, e.Secret)
+	case AlgRS256:
+		priv, pub, err := readPEMPair(e, jwt.ParseRSAPrivateKeyFromPEM, jwt.ParseRSAPublicKeyFromPEM)
+		if err != nil {
+			return nil, err
+		}
+		k = NewRSAKey(e.Kid, priv, pub)
+	case AlgEdDSA:
+		priv, pub, err := readPEMPair(e,
+			func(b []byte) (ed25519.PrivateKey, error) { return asEd25519(jwt.ParseEdPrivateKeyFromPEM(b)) },
+			func(b []byte) (ed25519.PublicKey, error) { return asEd25519Pub(jwt.ParseEdPublicKeyFromPEM(b)) },
+		)
+		if err != nil {
+			return nil, err
+		}
+		k = NewEd25519Key(e.Kid, priv, pub)
+	default:
+		return nil, fmt.Errorf("unsupported algorithm %q", e.Alg)
+	}
+	k.RetiredAt = e.RetiredAt
+	return k, nil
+}
+
+// readPEMPair loads the private key if configured, otherwise the public key.
+func readPEMPair[Priv, Pub any](e keyFileEntry, parsePriv func([]byte) (Priv, error), parsePub func([]byte) (Pub, error)) (Priv, Pub, error) {
+	var priv Priv
+	var pub Pub
+	switch {
+	case e.PrivateKeyFile != "":
+		b, err := os.ReadFile(e.PrivateKeyFile)
+		if err != nil {
+			return priv, pub, err
+		}
+		priv, err = parsePriv(b)
+		return priv, pub, err
+	case e.PublicKeyFile != "":
+		b, err := os.ReadFile(e.PublicKeyFile)
+		if err != nil {
+			return priv, pub, err
+		}
+		pub, err = parsePub(b)
+		return priv, pub, err
+	}
+	return priv, pub, errors.New("private_key_file or public_key_file required")
+}
+
+func asEd25519(k crypto.PrivateKey, err error) (ed25519.PrivateKey, error) {
+	if err != nil {
+		return nil, err
+	}
+	priv, ok := k.(ed25519.PrivateKey)
+	if !ok {
+		return nil, errors.New("not an Ed25519 private key")
+	}
+	return priv, nil
+}
+
+func asEd25519Pub(k crypto.PublicKey, err error) (ed25519.PublicKey, error) {
+	if err != nil {
+		return nil, err
+	}
+	pub, ok := k.(ed25519.PublicKey)
+	if !ok {
+		return nil, errors.New("not an Ed25519 public key")
+	}
+	return pub, nil
+}
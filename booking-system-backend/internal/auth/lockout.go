@@ -0,0 +1,231 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// LockoutPolicy tunes LoginLimiter. Once a key reaches its threshold of
+// failures inside Window it is locked for Base, doubling with every further
+// failure up to Max.
+type LockoutPolicy struct {
+	MaxPerEmail int
+	MaxPerIP    int
+	Window      time.Duration
+	Base        time.Duration
+	Max         time.Duration
+}
+
+// LoginLimiter counts failed logins per email and per client IP. Counters live
+// in Redis so every instance shares them; without Redis they are kept in
+// process memory.
+type LoginLimiter struct {
+	store  attemptStore
+	policy LockoutPolicy
+}
+
+func NewLoginLimiter(cache *redis.Client, policy LockoutPolicy) *LoginLimiter {
+	var store attemptStore = newMemoryAttemptStore()
+	if cache != nil {
+		store = &redisAttemptStore{cache: cache}
+	}
+	return &LoginLimiter{store: store, policy: policy}
+}
+
+func emailKey(email string) string { return "email:" + strings.ToLower(strings.TrimSpace(email)) }
+func ipKey(ip string) string       { return "ip:" + ip }
+
+// Blocked returns how long the caller must wait before trying again, or zero.
+// Store errors fail open so a Redis outage does not lock everyone out.
+func (l *LoginLimiter) Blocked(ctx context.Context, email, ip string) time.Duration {
+	var wait time.Duration
+	for _, key := range []string{emailKey(email), ipKey(ip)} {
+		d, err := l.store.lockedFor(ctx, key)
+		if err != nil {
+			log.Printf("login limiter: %v", err)
+			continue
+		}
+		if d > wait {
+			wait = d
+		}
+	}
+	return wait
+}
+
+// Fail records a failed attempt and returns the lockout it triggered, if any.
+func (l *LoginLimiter) Fail(ctx context.Context, email, ip string) time.Duration {
+	var wait time.Duration
+	for _, k := range []struct {
+		key string
+		max int
+	}{{emailKey(email), l.policy.MaxPerEmail}, {ipKey(ip), l.policy.MaxPerIP}} {
+		n, err := l.store.incr(ctx, k.key, l.policy.Window)
+		if err != nil {
+			log.Printf("login limiter: %v", err)
+			continue
+		}
+		if k.max <= 0 || int(n) < k.max {
+			continue
+		}
+		d := l.backoff(int(n) - k.max)
+		if err := l.store.lock(ctx, k.key, d); err != nil {
+			log.Printf("login limiter: %v", err)
+			continue
+		}
+		if d > wait {
+			wait = d
+		}
+	}
+	return wait
+}
+
+// Reset clears the failure counter and lock for an email, after a successful
+// login or when an admin unlocks the account. IP counters are left alone so a
+// valid login cannot be used to reset an attacker's address.
+func (l *LoginLimiter) Reset(ctx context.Context, email string) error {
+	return l.store.reset(ctx, emailKey(email))
+}
+
+func (l *LoginLimiter) backoff(excess int) time.Duration {
+	d := l.policy.Base
+	for i := 0; i < excess && d < l.policy.Max; i++ {
+		d *= 2
+	}
+	if d > l.policy.Max {
+		d = l.policy.Max
+	}
+	return d
+}
+
+type attemptStore interface {
+	incr(ctx context.Context, key string, window time.Duration) (int64, error)
+	lock(ctx context.Context, key string, d time.Duration) error
+	lockedFor(ctx context.Context, key string) (time.Duration, error)
+	reset(ctx context.Context, key string) error
+}
+
+type redisAttemptStore struct {
+	cache *redis.Client
+}
+
+// incr counts an attempt. The window starts at the first attempt: EXPIRE NX
+// only sets a TTL the key lacks, and running it in the same MULTI as the INCR
+// means a counter can never be left without one.
+func (s *redisAttemptStore) incr(ctx context.Context, key string, window time.Duration) (int64, error) {
+	k := fmt.Sprintf("login_fail:%s", key)
+	var n *redis.IntCmd
+	_, err := s.cache.TxPipelined(ctx, func(p redis.Pipeliner) error {
+		n = p.Incr(ctx, k)
+		p.ExpireNX(ctx, k, window)
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("incr %s: %w", k, err)
+	}
+	return n.Val(), nil
+}
+
+func (s *redisAttemptStore) lock(ctx context.Context, key string, d time.Duration) error {
+	return s.cache.Set(ctx, fmt.Sprintf("login_lock:%s", key), "1", d).Err()
+}
+
+func (s *redisAttemptStore) lockedFor(ctx context.Context, key string) (time.Duration, error) {
+	d, err := s.cache.PTTL(ctx, fmt.Sprintf("login_lock:%s", key)).Result()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	if d < 0 {
+		// -2: no key, -1: no expiry (should not happen)
+		return 0, nil
+	}
+	return d, nil
+}
+
+func (s *redisAttemptStore) reset(ctx context.Context, key string) error {
+	return s.cache.Del(ctx, fmt.Sprintf("login_fail:%s", key), fmt.Sprintf("login_lock:%s", key)).Err()
+}
+
+type memoryAttempts struct {
+	count       int64
+	windowEnd   time.Time
+	lockedUntil time.Time
+}
+
+type memoryAttemptStore struct {
+	mu      sync.Mutex
+	entries map[string]*memoryAttempts
+}
+
+func newMemoryAttemptStore() *memoryAttemptStore {
+	return &memoryAttemptStore{entries: map[string]*memoryAttempts{}}
+}
+
+func (s *memoryAttemptStore) incr(_ context.Context, key string, window time.Duration) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	if len(s.entries) > 10000 {
+		s.pruneLocked(now)
+	}
+	e := s.entries[key]
+	if e == nil {
+		e = &memoryAttempts{}
+		s.entries[key] = e
+	}
+	if now.After(e.windowEnd) {
+		e.count = 0
+		e.windowEnd = now.Add(window)
+	}
+	e.count++
+	return e.count, nil
+}
+
+func (s *memoryAttemptStore) pruneLocked(now time.Time) {
+	for k, e := range s.entries {
+		if now.After(e.windowEnd) && now.After(e.lockedUntil) {
+			delete(s.entries, k)
+		}
+	}
+}
+
+func (s *memoryAttemptStore) lock(_ context.Context, key string, d time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e := s.entries[key]
+	if e == nil {
+		e = &memoryAttempts{}
+		s.entries[key] = e
+	}
+	e.lockedUntil = time.Now().Add(d)
+	return nil
+}
+
+func (s *memoryAttemptStore) lockedFor(_ context.Context, key string) (time.Duration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e := s.entries[key]
+	if e == nil {
+		return 0, nil
+	}
+	if d := time.Until(e.lockedUntil); d > 0 {
+		return d, nil
+	}
+	return 0, nil
+}
+
+func (s *memoryAttemptStore) reset(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.entries, key)
+	return nil
+}
@@ -0,0 +1,68 @@
+package auth
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/temu-in/temu.in/booking-system-backend/internal/models"
+)
+
+func TestLoginUpgradesBcrypt(t *testing.T) {
+	e := newTestEnv(t, nil)
+	legacy, err := bcrypt.GenerateFromPassword([]byte("old-password-1"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u := &models.User{Email: "ana@example.com", Password: string(legacy), Role: models.RoleCustomer, IsVerified: true}
+	if err := e.users.Create(u); err != nil {
+		t.Fatal(err)
+	}
+	login := func(pw string) int {
+		return e.do(t, http.MethodPost, "/auth/login", loginReq{Email: "ana@example.com", Password: pw}).Code
+	}
+	stored := func() string {
+		got, err := e.users.FindByID(u.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return got.Password
+	}
+
+	if got := login("wrong-password"); got != http.StatusUnauthorized {
+		t.Fatalf("wrong password: status %d", got)
+	}
+	if stored() != string(legacy) {
+		t.Error("a failed login rehashed the password")
+	}
+	if got := login("old-password-1"); got != http.StatusOK {
+		t.Fatalf("bcrypt login: status %d", got)
+	}
+	upgraded := stored()
+	if !strings.HasPrefix(upgraded, "$argon2id$") {
+		t.Fatalf("password not upgraded: %q", upgraded)
+	}
+	if got := login("old-password-1"); got != http.StatusOK {
+		t.Fatalf("argon2id login: status %d", got)
+	}
+	if stored() != upgraded {
+		t.Error("a current hash was rehashed")
+	}
+}
+
+func TestLoginWithoutStoredHash(t *testing.T) {
+	e := newTestEnv(t, nil)
+	if err := e.users.Create(&models.User{Email: "fed@example.com", Role: models.RoleCustomer, IsVerified: true}); err != nil {
+		t.Fatal(err)
+	}
+	for _, email := range []string{"nobody@example.com", "fed@example.com"} {
+		w := e.do(t, http.MethodPost, "/auth/login", loginReq{Email: email, Password: "any-password-1"})
+		wantStatus(t, w, http.StatusUnauthorized)
+	}
+	// the failures were checked against a dummy hash
+	if e.h.dummyHash == "" {
+		t.Error("no dummy hash verified against")
+	}
+}
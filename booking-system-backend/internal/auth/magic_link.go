@@ -0,0 +1,177 @@
+package auth
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+
+	"github.com/temu-in/temu.in/booking-system-backend/internal/mail"
+	"github.com/temu-in/temu.in/booking-system-backend/internal/models"
+	"github.com/temu-in/temu.in/booking-system-backend/internal/token"
+)
+
+// MagicLinkNonceCookie binds a magic link to the browser that asked for it.
+const MagicLinkNonceCookie = "magic_link_nonce"
+
+// NewMagicLinkLimiter allows one magic link per address per cooldown and at
+// most maxPerIP requests per window from one client IP.
+func NewMagicLinkLimiter(cache *redis.Client, cooldown time.Duration, maxPerIP int, window time.Duration) *RequestLimiter {
+	return NewRequestLimiter(cache, "magic:", cooldown, maxPerIP, window)
+}
+
+// WithMagicLinkLimiter rate-limits RequestMagicLink.
+func WithMagicLinkLimiter(l *RequestLimiter) Option {
+	return func(h *Handler) { h.magicLimiter = l }
+}
+
+type magicLinkReq struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+// RequestMagicLink emails a single-use sign-in link. The link only works in
+// this browser: it is bound to a nonce set here as a cookie. Like
+// ForgotPassword it answers identically for unknown addresses, sending the
+// email after the response.
+func (h *Handler) RequestMagicLink(c *gin.Context) {
+	var req magicLinkReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if h.magicLimiter != nil {
+		if wait := h.magicLimiter.Allow(c.Request.Context(), req.Email, c.ClientIP()); wait > 0 {
+			tooManyAttempts(c, wait)
+			return
+		}
+	}
+
+	nonce, err := generateSecureToken(32)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal"})
+		return
+	}
+	u, err := h.repo.FindByEmail(req.Email)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal"})
+		return
+	}
+	if u != nil {
+		nonceHash := hashToken(nonce)
+		h.background(func(ctx context.Context) {
+			if err := h.sendMagicLink(ctx, u, nonceHash); err != nil {
+				log.Printf("magic link for user %d: %v", u.ID, err)
+			}
+		})
+	}
+	h.setMagicLinkNonce(c, nonce, h.config.MagicLinkTTL)
+
+	c.JSON(http.StatusOK, gin.H{"status": "magic_link_sent"})
+}
+
+func (h *Handler) sendMagicLink(ctx context.Context, u *models.User, nonceHash string) error {
+	raw, err := h.issueBoundActionToken(u.ID, token.PurposeMagicLink, h.config.MagicLinkTTL, nonceHash)
+	if err != nil {
+		return err
+	}
+
+	link := fmt.Sprintf("%s/magic-link?token=%s", h.config.AppURL, url.QueryEscape(raw))
+	return h.mailer.Send(ctx, mail.Message{
+		To:      u.Email,
+		Subject: "Your temu.in sign-in link",
+		Body: fmt.Sprintf("Open this link to sign in to temu.in:\n%s\n\n"+
+			"The link works once, in the browser you requested it from, and expires in %s. "+
+			"If you did not ask for it, you can ignore this email.", link, h.config.MagicLinkTTL),
+	})
+}
+
+type verifyMagicLinkReq struct {
+	Token      string `json:"token" binding:"required"`
+	RememberMe bool   `json:"remember_me"`
+}
+
+// VerifyMagicLink trades a link token for a session, as Login does for a
+// password. Opening the link proves the address, so it also verifies it. Users
+// with 2FA still get an MFA challenge.
+func (h *Handler) VerifyMagicLink(c *gin.Context) {
+	var req verifyMagicLinkReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	hash := hashToken(req.Token)
+	pending, err := h.tokens.FindAction(hash, token.PurposeMagicLink)
+	if err != nil {
+		if errors.Is(err, token.ErrActionTokenInvalid) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid or expired token"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal"})
+		return
+	}
+	// check the binding before consuming so a link opened elsewhere (or
+	// forwarded to an attacker) does not burn it for its owner
+	nonce, err := c.Cookie(MagicLinkNonceCookie)
+	if err != nil || subtle.ConstantTimeCompare([]byte(hashToken(nonce)), []byte(pending.BindingHash)) != 1 {
+		c.JSON(http.StatusForbidden, gin.H{"error": "open the link in the browser that requested it"})
+		return
+	}
+	rec, err := h.tokens.ConsumeAction(hash, token.PurposeMagicLink)
+	if err != nil {
+		if errors.Is(err, token.ErrActionTokenInvalid) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid or expired token"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal"})
+		return
+	}
+	h.setMagicLinkNonce(c, "", 0)
+
+	u, err := h.repo.FindByID(rec.UserID)
+	if err != nil || u == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid or expired token"})
+		return
+	}
+	if !u.IsVerified {
+		if err := h.repo.MarkVerified(u.ID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "internal"})
+			return
+		}
+		u.IsVerified = true
+	}
+
+	if u.TOTPEnabled {
+		h.mfaChallenge(c, u, AMREmail)
+		return
+	}
+	h.startSession(c, u, req.RememberMe, AMREmail)
+}
+
+// setMagicLinkNonce writes the nonce cookie, or clears it when nonce is
+// empty. It is scoped to the magic-link routes and shares the refresh cookie's
+// SameSite and Secure settings.
+func (h *Handler) setMagicLinkNonce(c *gin.Context, nonce string, ttl time.Duration) {
+	cookie := &http.Cookie{
+		Name:     MagicLinkNonceCookie,
+		Value:    nonce,
+		Path:     strings.TrimSuffix(c.Request.URL.Path, "/verify"),
+		Domain:   h.sessions.Domain,
+		MaxAge:   int(ttl.Seconds()),
+		HttpOnly: true,
+		Secure:   h.sessions.Secure,
+		SameSite: h.sessions.SameSite,
+	}
+	if nonce == "" {
+		cookie.MaxAge = -1
+	}
+	http.SetCookie(c.Writer, cookie)
+}
@@ -0,0 +1,389 @@
+package auth
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/temu-in/temu.in/booking-system-backend/internal/models"
+	"github.com/temu-in/temu.in/booking-system-backend/internal/token"
+)
+
+const (
+	EventMFARecoveryUsed = "mfa_recovery_code_used"
+	EventMFADisabled     = "mfa_disabled"
+
+	recoveryCodeCount = 10
+)
+
+// mfaChallenge answers a correct first factor for a 2FA user with a
+// short-lived challenge instead of a session. The client trades it in at
+// /2fa/verify. amr names the first factor.
+func (h *Handler) mfaChallenge(c *gin.Context, u *models.User, amr ...string) {
+	raw, err := h.issueMFAChallenge(u.ID, amr...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"mfa_required": true, "mfa_token": raw})
+}
+
+// issueMFAChallenge stores a challenge remembering the first factor amr.
+func (h *Handler) issueMFAChallenge(userID uint, amr ...string) (string, error) {
+	return h.storeActionToken(&models.ActionToken{UserID: userID, Purpose: token.PurposeMFAChallenge, ExpiresAt: time.Now().Add(h.config.MFAChallengeTTL), AMR: strings.Join(amr, " ")})
+}
+
+// withOTP returns amr with the otp method added.
+func withOTP(amr []string) []string {
+	out := make([]string, 0, len(amr)+1)
+	for _, m := range amr {
+		if m != AMROTP {
+			out = append(out, m)
+		}
+	}
+	return append(out, AMROTP)
+}
+
+type verifyMFAReq struct {
+	MFAToken     string `json:"mfa_token" binding:"required"`
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+	// RememberMe repeats the choice made on the password step.
+	RememberMe bool `json:"remember_me"`
+}
+
+// VerifyMFA completes a two-step login with a TOTP or recovery code. Wrong
+// codes count towards the same lockout as wrong passwords.
+func (h *Handler) VerifyMFA(c *gin.Context) {
+	var req verifyMFAReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Code == "" && req.RecoveryCode == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "code or recovery_code required"})
+		return
+	}
+
+	hash := hashToken(req.MFAToken)
+	challenge, err := h.tokens.FindAction(hash, token.PurposeMFAChallenge)
+	if err != nil {
+		if errors.Is(err, token.ErrActionTokenInvalid) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid or expired token"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal"})
+		return
+	}
+	u, err := h.repo.FindByID(challenge.UserID)
+	if err != nil || u == nil || !u.TOTPEnabled {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid or expired token"})
+		return
+	}
+
+	if h.reauthBlocked(c, u) {
+		return
+	}
+
+	var ok bool
+	if req.RecoveryCode != "" {
+		ok, err = h.tokens.ConsumeRecoveryCode(u.ID, hashToken(normalizeRecoveryCode(req.RecoveryCode)))
+		if ok {
+			h.securityEvent(c, EventMFARecoveryUsed, u.ID, "")
+		}
+	} else {
+		ok, err = h.checkTOTP(u, req.Code)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal"})
+		return
+	}
+	if !ok {
+		h.loginFailed(c, u.Email, u.ID)
+		return
+	}
+
+	// the challenge is single-use once it has been answered correctly
+	if _, err := h.tokens.ConsumeAction(hash, token.PurposeMFAChallenge); err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid or expired token"})
+		return
+	}
+	h.reauthPassed(c, u)
+
+	h.startSession(c, u, req.RememberMe, withOTP(strings.Fields(challenge.AMR))...)
+}
+
+// checkTOTP validates a code against the user's secret and burns its time
+// step so the same code cannot be replayed.
+func (h *Handler) checkTOTP(u *models.User, code string) (bool, error) {
+	if u.TOTPSecret == "" {
+		return false, nil
+	}
+	step, ok := validateTOTP(u.TOTPSecret, code, time.Now())
+	if !ok {
+		return false, nil
+	}
+	return h.repo.UseTOTPStep(u.ID, step)
+}
+
+// currentUser loads the user behind the access token set by Middleware.
+func (h *Handler) currentUser(c *gin.Context) (*models.User, bool) {
+	claims, ok := claimsFrom(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthenticated"})
+		return nil, false
+	}
+	u, err := h.repo.FindByID(claims.UserID)
+	if err != nil || u == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthenticated"})
+		return nil, false
+	}
+	return u, true
+}
+
+// SetupTOTP starts enrollment by generating a secret and the otpauth URI the
+// client renders as a QR code. 2FA is not enforced until EnableTOTP.
+func (h *Handler) SetupTOTP(c *gin.Context) {
+	u, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+	if u.TOTPEnabled {
+		c.JSON(http.StatusConflict, gin.H{"error": "2fa already enabled"})
+		return
+	}
+
+	secret, err := newTOTPSecret()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal"})
+		return
+	}
+	if err := h.repo.SetTOTPSecret(u.ID, secret); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"secret": secret, "otpauth_uri": totpURI(h.config.TOTPIssuer, u.Email, secret)})
+}
+
+type totpCodeReq struct {
+	Code string `json:"code" binding:"required"`
+}
+
+// EnableTOTP confirms enrollment with a first code. It returns the recovery
+// codes (shown once) and a fresh session that carries the otp marker.
+func (h *Handler) EnableTOTP(c *gin.Context) {
+	var req totpCodeReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	u, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+	if u.TOTPEnabled {
+		c.JSON(http.StatusConflict, gin.H{"error": "2fa already enabled"})
+		return
+	}
+	if u.TOTPSecret == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "2fa setup not started"})
+		return
+	}
+
+	valid, err := h.checkTOTP(u, req.Code)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal"})
+		return
+	}
+	if !valid {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid code"})
+		return
+	}
+
+	if err := h.repo.EnableTOTP(u.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal"})
+		return
+	}
+	codes, err := h.replaceRecoveryCodes(u.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal"})
+		return
+	}
+	// the new session keeps however the current one signed in
+	var amr []string
+	if claims, ok := claimsFrom(c); ok {
+		amr = claims.AMR
+	}
+	token, err := h.issueSession(c, u, h.currentRememberMe(c), withOTP(amr)...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "token"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "2fa_enabled", "recovery_codes": codes, "token": token})
+}
+
+type disableTOTPReq struct {
+	Password string `json:"password" binding:"required"`
+	Code     string `json:"code" binding:"required"`
+}
+
+// DisableTOTP turns 2FA off after re-checking both factors. Roles for which
+// 2FA is mandatory cannot opt out. Wrong answers count towards the login
+// lockout, so a hijacked session cannot be used to guess them.
+func (h *Handler) DisableTOTP(c *gin.Context) {
+	var req disableTOTPReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	u, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+	if !u.TOTPEnabled {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "2fa not enabled"})
+		return
+	}
+	if h.mfaRequired(u.Role) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "2fa is mandatory for this role"})
+		return
+	}
+	if h.reauthBlocked(c, u) {
+		return
+	}
+
+	if ok, _ := h.hasher.Verify(req.Password, u.Password); !ok {
+		h.loginFailed(c, u.Email, u.ID)
+		return
+	}
+	valid, err := h.checkTOTP(u, req.Code)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal"})
+		return
+	}
+	if !valid {
+		h.loginFailed(c, u.Email, u.ID)
+		return
+	}
+	h.reauthPassed(c, u)
+
+	if err := h.repo.DisableTOTP(u.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal"})
+		return
+	}
+	if err := h.tokens.ReplaceRecoveryCodes(u.ID, nil); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal"})
+		return
+	}
+	h.securityEvent(c, EventMFADisabled, u.ID, "")
+
+	c.JSON(http.StatusOK, gin.H{"status": "2fa_disabled"})
+}
+
+// RegenerateRecoveryCodes replaces all recovery codes after a TOTP check.
+// Like DisableTOTP it is subject to the login lockout.
+func (h *Handler) RegenerateRecoveryCodes(c *gin.Context) {
+	var req totpCodeReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	u, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+	if !u.TOTPEnabled {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "2fa not enabled"})
+		return
+	}
+	if h.reauthBlocked(c, u) {
+		return
+	}
+
+	valid, err := h.checkTOTP(u, req.Code)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal"})
+		return
+	}
+	if !valid {
+		h.loginFailed(c, u.Email, u.ID)
+		return
+	}
+	h.reauthPassed(c, u)
+
+	codes, err := h.replaceRecoveryCodes(u.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"recovery_codes": codes})
+}
+
+// reauthBlocked answers with 429 when u is locked out by the login limiter.
+// Endpoints that re-check a factor call it first and report failures with
+// loginFailed, so guesses there count the same as at login.
+func (h *Handler) reauthBlocked(c *gin.Context, u *models.User) bool {
+	if h.limiter == nil {
+		return false
+	}
+	if wait := h.limiter.Blocked(c.Request.Context(), u.Email, c.ClientIP()); wait > 0 {
+		tooManyAttempts(c, wait)
+		return true
+	}
+	return false
+}
+
+// reauthPassed clears the failures counted by reauthBlocked's callers.
+func (h *Handler) reauthPassed(c *gin.Context, u *models.User) {
+	if h.limiter != nil {
+		_ = h.limiter.Reset(c.Request.Context(), u.Email)
+	}
+}
+
+func (h *Handler) replaceRecoveryCodes(userID uint) ([]string, error) {
+	codes, err := newRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		return nil, err
+	}
+	hashes := make([]string, len(codes))
+	for i, code := range codes {
+		hashes[i] = hashToken(code)
+	}
+	if err := h.tokens.ReplaceRecoveryCodes(userID, hashes); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+func (h *Handler) mfaRequired(role models.Role) bool {
+	return role.IsStaff() && h.config.MFARequiredForAdmin
+}
+
+// RequireMFA rejects sessions that neither passed a second factor nor logged
+// in with a passkey. The server mounts it on the admin API when
+// MFA_REQUIRED_FOR_ADMIN is set; staff without 2FA can still reach
+// /api/auth/2fa to enroll.
+func RequireMFA() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		v, ok := c.Get(UserContextKey)
+		if !ok {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "missing claims"})
+			return
+		}
+		claims, ok := v.(*Claims)
+		if !ok {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "invalid claims"})
+			return
+		}
+		if !claims.HasAMR(AMROTP) && !claims.HasAMR(AMRMFA) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "2fa required"})
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,81 @@
+package auth
+
+import (
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMFAManagementLockout(t *testing.T) {
+	limiter := NewLoginLimiter(nil, LockoutPolicy{MaxPerEmail: 3, MaxPerIP: 100, Window: time.Hour, Base: time.Minute, Max: time.Hour})
+	e := newTestEnv(t, nil, WithLoginLimiter(limiter))
+	u := e.createUser(t, "ana@example.com", "old-password-1")
+	if err := e.db.Model(u).Updates(map[string]interface{}{"totp_secret": "JBSWY3DPEHPK3PXP", "totp_enabled": true}).Error; err != nil {
+		t.Fatal(err)
+	}
+	auth := e.bearer(t, u)
+
+	// failures at both endpoints add up
+	w := e.do(t, http.MethodPost, "/auth/2fa/disable", disableTOTPReq{Password: "wrong-password", Code: "123456"}, auth...)
+	wantStatus(t, w, http.StatusUnauthorized)
+	w = e.do(t, http.MethodPost, "/auth/2fa/recovery-codes", totpCodeReq{Code: "nope"}, auth...)
+	wantStatus(t, w, http.StatusUnauthorized)
+	w = e.do(t, http.MethodPost, "/auth/2fa/disable", disableTOTPReq{Password: "old-password-1", Code: "nope"}, auth...)
+	wantStatus(t, w, http.StatusTooManyRequests)
+
+	// locked out, even with the right password
+	w = e.do(t, http.MethodPost, "/auth/2fa/disable", disableTOTPReq{Password: "old-password-1", Code: "nope"}, auth...)
+	wantStatus(t, w, http.StatusTooManyRequests)
+	w = e.do(t, http.MethodPost, "/auth/2fa/recovery-codes", totpCodeReq{Code: "nope"}, auth...)
+	wantStatus(t, w, http.StatusTooManyRequests)
+	// and so is the login itself
+	w = e.do(t, http.MethodPost, "/auth/login", loginReq{Email: "ana@example.com", Password: "old-password-1"})
+	wantStatus(t, w, http.StatusTooManyRequests)
+}
+
+func TestMFAKeepsFirstFactor(t *testing.T) {
+	e := newTestEnv(t, nil)
+	u := e.createUser(t, "ana@example.com", "old-password-1")
+	const secret = "JBSWY3DPEHPK3PXP"
+	if err := e.db.Model(u).Updates(map[string]interface{}{"totp_secret": secret, "totp_enabled": true}).Error; err != nil {
+		t.Fatal(err)
+	}
+	key, err := b32.DecodeString(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// three logins fit in the window of accepted steps
+	step := time.Now().Unix()/totpPeriod - totpSkew
+	verify := func(mfaToken string) []string {
+		t.Helper()
+		// each code works once, so use the next step every time
+		code := totpCode(key, step)
+		step++
+		w := e.do(t, http.MethodPost, "/auth/2fa/verify", verifyMFAReq{MFAToken: mfaToken, Code: code})
+		wantStatus(t, w, http.StatusOK)
+		claims, err := ParseToken(e.keys, decode(t, w)["token"].(string))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return claims.AMR
+	}
+
+	w := e.do(t, http.MethodPost, "/auth/login", loginReq{Email: "ana@example.com", Password: "old-password-1"})
+	wantStatus(t, w, http.StatusOK)
+	if got := verify(decode(t, w)["mfa_token"].(string)); !reflect.DeepEqual(got, []string{AMRPassword, AMROTP}) {
+		t.Errorf("after password: amr %v", got)
+	}
+
+	// a challenge reached without a password does not claim one
+	for _, first := range []string{AMREmail, AMRFederated} {
+		raw, err := e.h.issueMFAChallenge(u.ID, first)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := verify(raw); !reflect.DeepEqual(got, []string{first, AMROTP}) {
+			t.Errorf("after %s: amr %s", first, strings.Join(got, " "))
+		}
+	}
+}
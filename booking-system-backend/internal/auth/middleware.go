@@ -1,55 +1,128 @@
 package auth
 
 import (
-    "net/http"
-    "strings"
+	"net/http"
+	"strings"
 
-    "github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin"
+
+	"github.com/temu-in/temu.in/booking-system-backend/internal/audit"
+	"github.com/temu-in/temu.in/booking-system-backend/internal/models"
 )
 
 const UserContextKey = "user_claims"
 
-func Middleware(secret string) gin.HandlerFunc {
-    return func(c *gin.Context) {
-        auth := c.GetHeader("Authorization")
-        if auth == "" {
-            c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "missing auth"})
-            return
-        }
-        parts := strings.SplitN(auth, " ", 2)
-        if len(parts) != 2 || parts[0] != "Bearer" {
-            c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid auth header"})
-            return
-        }
-
-        claims, err := ParseToken(secret, parts[1])
-        if err != nil {
-            c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid token"})
-            return
-        }
-
-        c.Set(UserContextKey, claims)
-        c.Next()
-    }
+// MiddlewareOption adds checks to Middleware beyond signature and expiry.
+type MiddlewareOption func(*middlewareConfig)
+
+type middlewareConfig struct {
+	denylist *Denylist
+	apiKeys  *apiKeyAuth
+	versions *VersionCache
+
+	impersonationAudit *audit.Repository
+}
+
+// CheckDenylist rejects tokens that were revoked before they expired.
+func CheckDenylist(d *Denylist) MiddlewareOption {
+	return func(mc *middlewareConfig) { mc.denylist = d }
+}
+
+// CheckSecurityVersion rejects tokens issued before the user's last role,
+// password or status change.
+func CheckSecurityVersion(v *VersionCache) MiddlewareOption {
+	return func(mc *middlewareConfig) { mc.versions = v }
+}
+
+func Middleware(keys *Keyring, opts ...MiddlewareOption) gin.HandlerFunc {
+	var mc middlewareConfig
+	for _, opt := range opts {
+		opt(&mc)
+	}
+	return func(c *gin.Context) {
+		if c.GetHeader("Authorization") == "" {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "missing auth"})
+			return
+		}
+		raw, ok := bearerToken(c)
+		if !ok {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid auth header"})
+			return
+		}
+
+		if strings.HasPrefix(raw, APIKeyPrefix) && mc.apiKeys != nil {
+			claims, err := mc.apiKeys.principal(raw)
+			if err != nil {
+				c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "internal"})
+				return
+			}
+			if claims == nil {
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid api key"})
+				return
+			}
+			c.Set(UserContextKey, claims)
+			c.Next()
+			return
+		}
+
+		claims, err := ParseToken(keys, raw)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid token"})
+			return
+		}
+		if mc.denylist != nil && mc.denylist.IsRevoked(c.Request.Context(), claims) {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "token revoked"})
+			return
+		}
+		if mc.versions != nil {
+			stale, err := mc.versions.Stale(claims)
+			if err != nil {
+				c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "internal"})
+				return
+			}
+			if stale {
+				// the client refreshes and gets a token reflecting the change
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "token revoked"})
+				return
+			}
+		}
+
+		c.Set(UserContextKey, claims)
+		if claims.IsImpersonation() && mc.impersonationAudit != nil {
+			auditImpersonated(c, mc.impersonationAudit, claims)
+			return
+		}
+		c.Next()
+	}
+}
+
+// RequireRole returns middleware that checks the JWT role claim. New routes
+// should prefer Authorizer.RequirePermission.
+func RequireRole(role models.Role) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		v, ok := c.Get(UserContextKey)
+		if !ok {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "missing claims"})
+			return
+		}
+		claims, ok := v.(*Claims)
+		if !ok {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "invalid claims"})
+			return
+		}
+		if claims.Role != role {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "insufficient role"})
+			return
+		}
+		c.Next()
+	}
 }
 
-// RequireRole returns middleware that checks the JWT role claim
-func RequireRole(role string) gin.HandlerFunc {
-    return func(c *gin.Context) {
-        v, ok := c.Get(UserContextKey)
-        if !ok {
-            c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "missing claims"})
-            return
-        }
-        claims, ok := v.(*Claims)
-        if !ok {
-            c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "invalid claims"})
-            return
-        }
-        if claims.Role != role {
-            c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "insufficient role"})
-            return
-        }
-        c.Next()
-    }
+// bearerToken extracts the token from an "Authorization: Bearer" header.
+func bearerToken(c *gin.Context) (string, bool) {
+	parts := strings.SplitN(c.GetHeader("Authorization"), " ", 2)
+	if len(parts) != 2 || parts[0] != "Bearer" {
+		return "", false
+	}
+	return parts[1], true
 }
@@ -0,0 +1,440 @@
+package auth
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"golang.org/x/oauth2"
+
+	"github.com/temu-in/temu.in/booking-system-backend/internal/config"
+	"github.com/temu-in/temu.in/booking-system-backend/internal/models"
+)
+
+const (
+	EventIdentityLinked   = "identity_linked"
+	EventIdentityUnlinked = "identity_unlinked"
+
+	// GoogleIssuer is the issuer used for the built-in "google" provider.
+	GoogleIssuer = "https://accounts.google.com"
+
+	ceremonyOIDC    = "oidc"
+	oidcStateCookie = "oidc_state"
+	oidcLoginTTL    = 10 * time.Minute
+)
+
+// OIDCProviderConfig describes one OpenID Connect provider.
+type OIDCProviderConfig struct {
+	Name         string
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	Scopes       []string
+}
+
+// OIDC signs users in through external OpenID Connect providers with the
+// authorization code flow and PKCE.
+type OIDC struct {
+	providers   map[string]*oidcProvider
+	callbackURL string
+	ceremonies  *ceremonyStore
+	client      *http.Client
+}
+
+// oidcProvider discovers its endpoints on first use, so a provider that is
+// down does not keep the server from starting.
+type oidcProvider struct {
+	OIDCProviderConfig
+
+	mu       sync.Mutex
+	provider *oidc.Provider
+}
+
+// NewOIDC builds the providers; callbacks go to callbackURL +
+// "/<name>/callback". cache may be nil on a single instance.
+func NewOIDC(callbackURL string, cache *redis.Client, providers ...OIDCProviderConfig) *OIDC {
+	o := &OIDC{
+		providers:   map[string]*oidcProvider{},
+		callbackURL: strings.TrimSuffix(callbackURL, "/"),
+		ceremonies:  newCeremonyStore(cache),
+		client:      &http.Client{Timeout: 10 * time.Second},
+	}
+	for _, p := range providers {
+		if len(p.Scopes) == 0 {
+			p.Scopes = []string{oidc.ScopeOpenID, "email", "profile"}
+		}
+		o.providers[p.Name] = &oidcProvider{OIDCProviderConfig: p}
+	}
+	return o
+}
+
+// OIDCFromConfig enables Google when GOOGLE_CLIENT_ID is set and a generic
+// provider when OIDC_ISSUER is set. It returns nil when neither is.
+func OIDCFromConfig(cfg *config.Config, cache *redis.Client) *OIDC {
+	var providers []OIDCProviderConfig
+	if cfg.GoogleClientID != "" {
+		providers = append(providers, OIDCProviderConfig{Name: "google", Issuer: GoogleIssuer, ClientID: cfg.GoogleClientID, ClientSecret: cfg.GoogleClientSecret})
+	}
+	if cfg.OIDCIssuer != "" {
+		providers = append(providers, OIDCProviderConfig{Name: cfg.OIDCProviderName, Issuer: cfg.OIDCIssuer, ClientID: cfg.OIDCClientID, ClientSecret: cfg.OIDCClientSecret, Scopes: cfg.OIDCScopes})
+	}
+	if len(providers) == 0 {
+		return nil
+	}
+	return NewOIDC(cfg.OIDCCallbackURL, cache, providers...)
+}
+
+// WithOIDC enables login through external OpenID Connect providers.
+func WithOIDC(o *OIDC) Option {
+	return func(h *Handler) { h.oidc = o }
+}
+
+func (o *OIDC) context(ctx context.Context) context.Context {
+	return oidc.ClientContext(ctx, o.client)
+}
+
+// discover returns the provider's metadata, fetching it on first use.
+func (o *OIDC) discover(p *oidcProvider) (*oidc.Provider, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.provider == nil {
+		// not the request context: the provider keeps it for fetching keys
+		provider, err := oidc.NewProvider(o.context(context.Background()), p.Issuer)
+		if err != nil {
+			return nil, fmt.Errorf("discover %s: %w", p.Issuer, err)
+		}
+		p.provider = provider
+	}
+	return p.provider, nil
+}
+
+func (o *OIDC) oauth2Config(p *oidcProvider, provider *oidc.Provider) *oauth2.Config {
+	return &oauth2.Config{
+		ClientID:     p.ClientID,
+		ClientSecret: p.ClientSecret,
+		Endpoint:     provider.Endpoint(),
+		RedirectURL:  o.callbackURL + "/" + url.PathEscape(p.Name) + "/callback",
+		Scopes:       p.Scopes,
+	}
+}
+
+// oidcLogin is what the store keeps between the redirect to the provider and
+// its callback. The store id doubles as the OAuth state.
+type oidcLogin struct {
+	Provider   string `json:"provider"`
+	Nonce      string `json:"nonce"`
+	Verifier   string `json:"verifier"`
+	RememberMe bool   `json:"remember_me"`
+}
+
+// oidcClaims are the ID token claims used to find or create the user.
+// email_verified is a string with some providers.
+type oidcClaims struct {
+	Email         string `json:"email"`
+	EmailVerified any    `json:"email_verified"`
+	Name          string `json:"name"`
+}
+
+func (c *oidcClaims) emailVerified() bool {
+	switch v := c.EmailVerified.(type) {
+	case bool:
+		return v
+	case string:
+		b, _ := strconv.ParseBool(v)
+		return b
+	}
+	return false
+}
+
+func (h *Handler) registerOIDCRoutes(rg *gin.RouterGroup) {
+	rg.GET("/oidc/providers", h.ListOIDCProviders)
+	rg.GET("/oidc/:provider/login", h.BeginOIDCLogin)
+	rg.GET("/oidc/:provider/callback", h.OIDCCallback)
+}
+
+// RegisterIdentityRoutes mounts linked-account management under /api/me; rg
+// must already require an interactive session.
+func (h *Handler) RegisterIdentityRoutes(rg *gin.RouterGroup) {
+	if h.oidc == nil {
+		return
+	}
+	rg.GET("/identities", h.ListIdentities)
+	rg.DELETE("/identities/:id", h.UnlinkIdentity)
+}
+
+func (h *Handler) ListOIDCProviders(c *gin.Context) {
+	names := make([]string, 0, len(h.oidc.providers))
+	for name := range h.oidc.providers {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	c.JSON(http.StatusOK, gin.H{"providers": names})
+}
+
+// BeginOIDCLogin redirects the browser to the provider. The state is also set
+// as a cookie so the callback only completes in the browser that started the
+// login.
+func (h *Handler) BeginOIDCLogin(c *gin.Context) {
+	p, ok := h.oidc.providers[c.Param("provider")]
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "unknown provider"})
+		return
+	}
+	provider, err := h.oidc.discover(p)
+	if err != nil {
+		log.Printf("oidc %s: %v", p.Name, err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "provider unavailable"})
+		return
+	}
+	nonce, err := generateSecureToken(24)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal"})
+		return
+	}
+	remember, _ := strconv.ParseBool(c.Query("remember_me"))
+	login := oidcLogin{Provider: p.Name, Nonce: nonce, Verifier: oauth2.GenerateVerifier(), RememberMe: remember}
+	state, err := h.oidc.ceremonies.put(c.Request.Context(), ceremonyOIDC, login, oidcLoginTTL)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal"})
+		return
+	}
+
+	h.setOIDCState(c, state, oidcLoginTTL)
+	authURL := h.oidc.oauth2Config(p, provider).AuthCodeURL(state, oidc.Nonce(nonce), oauth2.S256ChallengeOption(login.Verifier))
+	c.Redirect(http.StatusFound, authURL)
+}
+
+// OIDCCallback completes the login and sends the browser back to the app with
+// a refresh cookie set; the app then calls /refresh for an access token.
+// Failures are reported to the app as ?error=<code>.
+func (h *Handler) OIDCCallback(c *gin.Context) {
+	stateCookie, _ := c.Cookie(oidcStateCookie)
+	h.setOIDCState(c, "", 0)
+	if e := c.Query("error"); e != "" {
+		log.Printf("oidc %s: provider returned %s: %s", c.Param("provider"), e, c.Query("error_description"))
+		h.oidcDone(c, "provider_error", "")
+		return
+	}
+
+	state := c.Query("state")
+	if state == "" || subtle.ConstantTimeCompare([]byte(state), []byte(stateCookie)) != 1 {
+		h.oidcDone(c, "invalid_state", "")
+		return
+	}
+	var login oidcLogin
+	found, err := h.oidc.ceremonies.take(c.Request.Context(), ceremonyOIDC, state, &login)
+	if err != nil {
+		h.oidcDone(c, "internal", "")
+		return
+	}
+	p, ok := h.oidc.providers[c.Param("provider")]
+	if !found || !ok || login.Provider != p.Name {
+		h.oidcDone(c, "invalid_state", "")
+		return
+	}
+	provider, err := h.oidc.discover(p)
+	if err != nil {
+		log.Printf("oidc %s: %v", p.Name, err)
+		h.oidcDone(c, "provider_unavailable", "")
+		return
+	}
+
+	ctx := h.oidc.context(c.Request.Context())
+	tok, err := h.oidc.oauth2Config(p, provider).Exchange(ctx, c.Query("code"), oauth2.VerifierOption(login.Verifier))
+	if err != nil {
+		log.Printf("oidc %s: exchange code: %v", p.Name, err)
+		h.oidcDone(c, "exchange_failed", "")
+		return
+	}
+	raw, _ := tok.Extra("id_token").(string)
+	if raw == "" {
+		h.oidcDone(c, "invalid_id_token", "")
+		return
+	}
+	// checks signature against the provider's JWKS, issuer, audience and expiry
+	idToken, err := provider.Verifier(&oidc.Config{ClientID: p.ClientID}).Verify(ctx, raw)
+	if err != nil {
+		log.Printf("oidc %s: verify id token: %v", p.Name, err)
+		h.oidcDone(c, "invalid_id_token", "")
+		return
+	}
+	if subtle.ConstantTimeCompare([]byte(idToken.Nonce), []byte(login.Nonce)) != 1 {
+		h.oidcDone(c, "invalid_id_token", "")
+		return
+	}
+	var claims oidcClaims
+	if err := idToken.Claims(&claims); err != nil {
+		h.oidcDone(c, "invalid_id_token", "")
+		return
+	}
+
+	u, code := h.oidcUser(c, p.Name, idToken.Subject, &claims)
+	if u == nil {
+		h.oidcDone(c, code, "")
+		return
+	}
+	if u.TOTPEnabled {
+		raw, err := h.issueMFAChallenge(u.ID, AMRFederated)
+		if err != nil {
+			h.oidcDone(c, "internal", "")
+			return
+		}
+		// in the fragment so it stays out of server logs and Referer headers
+		h.oidcDone(c, "", "mfa_token="+url.QueryEscape(raw))
+		return
+	}
+	if _, err := h.issueSession(c, u, login.RememberMe, AMRFederated); err != nil {
+		if errors.Is(err, ErrAccountSuspended) {
+			h.oidcDone(c, "account_suspended", "")
+			return
+		}
+		h.oidcDone(c, "internal", "")
+		return
+	}
+	h.oidcDone(c, "", "")
+}
+
+// oidcUser finds the user behind a provider account, linking or creating one
+// by verified email on first login. On failure it returns an error code for
+// the app.
+func (h *Handler) oidcUser(c *gin.Context, provider, subject string, claims *oidcClaims) (*models.User, string) {
+	ident, err := h.repo.FindIdentity(provider, subject)
+	if err != nil {
+		return nil, "internal"
+	}
+	if ident != nil {
+		u, err := h.repo.FindByID(ident.UserID)
+		if err != nil || u == nil {
+			return nil, "internal"
+		}
+		if err := h.repo.TouchIdentity(ident.ID, claims.Email); err != nil {
+			log.Printf("oidc identity %d: record login: %v", ident.ID, err)
+		}
+		return u, ""
+	}
+
+	// only an address the provider vouches for may claim or create an account
+	if claims.Email == "" || !claims.emailVerified() {
+		return nil, "email_not_verified"
+	}
+	now := time.Now()
+	ident = &models.Identity{Provider: provider, Subject: subject, Email: claims.Email, LastLoginAt: &now}
+	u, err := h.repo.FindByEmail(claims.Email)
+	if err != nil {
+		return nil, "internal"
+	}
+	if u == nil {
+		u = &models.User{Email: claims.Email, Name: claims.Name, Role: models.RoleCustomer, IsVerified: true, VerifiedAt: &now, SecurityVersion: 1}
+		if err := h.repo.CreateWithIdentity(u, ident); err != nil {
+			return nil, "internal"
+		}
+		h.securityEvent(c, EventIdentityLinked, u.ID, fmt.Sprintf("provider=%s new account", provider))
+		return u, ""
+	}
+
+	if !u.IsVerified {
+		// whoever registered the address never proved they own it; lock them
+		// out before handing the account to the provider's user
+		if err := h.repo.ClaimUnverified(u.ID); err != nil {
+			return nil, "internal"
+		}
+		if err := h.tokens.RevokeAllForUser(u.ID); err != nil {
+			return nil, "internal"
+		}
+		if h.denylist != nil {
+			h.denylist.RevokeUser(c.Request.Context(), u.ID)
+		}
+		if u, err = h.repo.FindByID(u.ID); err != nil {
+			return nil, "internal"
+		}
+	}
+	ident.UserID = u.ID
+	if err := h.repo.CreateIdentity(ident); err != nil {
+		return nil, "internal"
+	}
+	h.securityEvent(c, EventIdentityLinked, u.ID, fmt.Sprintf("provider=%s", provider))
+	return u, ""
+}
+
+// oidcDone redirects back to the app's callback page.
+func (h *Handler) oidcDone(c *gin.Context, errCode, fragment string) {
+	target := h.config.AppURL + "/oidc/callback"
+	if errCode != "" {
+		target += "?error=" + url.QueryEscape(errCode)
+	}
+	if fragment != "" {
+		target += "#" + fragment
+	}
+	c.Redirect(http.StatusFound, target)
+}
+
+// setOIDCState writes the state cookie, or clears it when state is empty. It
+// is Lax whatever the refresh cookie uses, as the callback is a cross-site
+// navigation from the provider.
+func (h *Handler) setOIDCState(c *gin.Context, state string, ttl time.Duration) {
+	cookie := &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    state,
+		Path:     path.Dir(path.Dir(c.Request.URL.Path)), // .../oidc
+		Domain:   h.sessions.Domain,
+		MaxAge:   int(ttl.Seconds()),
+		HttpOnly: true,
+		Secure:   h.sessions.Secure,
+		SameSite: http.SameSiteLaxMode,
+	}
+	if state == "" {
+		cookie.MaxAge = -1
+	}
+	http.SetCookie(c.Writer, cookie)
+}
+
+func (h *Handler) ListIdentities(c *gin.Context) {
+	claims, ok := claimsFrom(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthenticated"})
+		return
+	}
+	idents, err := h.repo.ListIdentities(claims.UserID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"identities": idents})
+}
+
+func (h *Handler) UnlinkIdentity(c *gin.Context) {
+	claims, ok := claimsFrom(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthenticated"})
+		return
+	}
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	found, err := h.repo.DeleteIdentity(claims.UserID, uint(id))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed"})
+		return
+	}
+	if !found {
+		c.JSON(http.StatusNotFound, gin.H{"error": "identity not found"})
+		return
+	}
+	h.securityEvent(c, EventIdentityUnlinked, claims.UserID, fmt.Sprintf("identity=%d", id))
+	c.JSON(http.StatusOK, gin.H{"status": "unlinked"})
+}
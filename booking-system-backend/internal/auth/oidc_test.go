@@ -0,0 +1,292 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+
+	"github.com/temu-in/temu.in/booking-system-backend/internal/models"
+)
+
+// stubIssuer is an OpenID provider serving discovery, keys and the token
+// endpoint. Tests stand in for the browser at its authorization endpoint by
+// calling grant with the URL the login redirected to.
+type stubIssuer struct {
+	*httptest.Server
+	key *rsa.PrivateKey
+
+	mu     sync.Mutex
+	grants map[string]stubGrant
+}
+
+type stubGrant struct {
+	challenge string
+	claims    jwt.MapClaims
+}
+
+func newStubIssuer(t *testing.T) *stubIssuer {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &stubIssuer{key: key, grants: map[string]stubGrant{}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"issuer":                                s.URL,
+			"authorization_endpoint":                s.URL + "/authorize",
+			"token_endpoint":                        s.URL + "/token",
+			"jwks_uri":                              s.URL + "/keys",
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+		})
+	})
+	mux.HandleFunc("/keys", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": "test",
+			"alg": "RS256",
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", s.token)
+	s.Server = httptest.NewServer(mux)
+	t.Cleanup(s.Close)
+	return s
+}
+
+// grant plays the user approving the login at location. Claims not set by
+// the test default to those of a verified address; a nil value leaves the
+// claim out.
+func (s *stubIssuer) grant(t *testing.T, location string, claims jwt.MapClaims) string {
+	t.Helper()
+	u, err := url.Parse(location)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := u.Query()
+	if !strings.HasPrefix(location, s.URL+"/authorize") || q.Get("code_challenge_method") != "S256" || q.Get("code_challenge") == "" {
+		t.Fatalf("unexpected authorization request %s", location)
+	}
+	all := jwt.MapClaims{
+		"iss":            s.URL,
+		"aud":            "client",
+		"sub":            "subject-1",
+		"email":          "ana@example.com",
+		"email_verified": true,
+		"nonce":          q.Get("nonce"),
+		"iat":            time.Now().Unix(),
+		"exp":            time.Now().Add(time.Minute).Unix(),
+	}
+	for k, v := range claims {
+		if v == nil {
+			delete(all, k)
+			continue
+		}
+		all[k] = v
+	}
+	code := newFamilyID()
+	s.mu.Lock()
+	s.grants[code] = stubGrant{challenge: q.Get("code_challenge"), claims: all}
+	s.mu.Unlock()
+	return code
+}
+
+func (s *stubIssuer) token(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	g, ok := s.grants[r.PostFormValue("code")]
+	delete(s.grants, r.PostFormValue("code"))
+	s.mu.Unlock()
+	sum := sha256.Sum256([]byte(r.PostFormValue("code_verifier")))
+	if !ok || base64.RawURLEncoding.EncodeToString(sum[:]) != g.challenge {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"error":"invalid_grant"}`))
+		return
+	}
+	tok := jwt.NewWithClaims(jwt.SigningMethodRS256, g.claims)
+	tok.Header["kid"] = "test"
+	idToken, err := tok.SignedString(s.key)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"access_token": "access",
+		"token_type":   "Bearer",
+		"expires_in":   60,
+		"id_token":     idToken,
+	})
+}
+
+func newOIDCEnv(t *testing.T, iss *stubIssuer) *testEnv {
+	t.Helper()
+	o := NewOIDC("http://localhost:8080/auth/oidc", nil, OIDCProviderConfig{Name: "test", Issuer: iss.URL, ClientID: "client", ClientSecret: "secret"})
+	return newTestEnv(t, nil, WithOIDC(o))
+}
+
+// beginOIDC starts a login and returns where it redirected to and the state
+// cookie it set.
+func (e *testEnv) beginOIDC(t *testing.T) (location, state string) {
+	t.Helper()
+	w := e.do(t, http.MethodGet, "/auth/oidc/test/login", nil)
+	wantStatus(t, w, http.StatusFound)
+	for _, ck := range w.Result().Cookies() {
+		if ck.Name == oidcStateCookie {
+			state = ck.Value
+		}
+	}
+	if state == "" {
+		t.Fatal("no state cookie")
+	}
+	return w.Header().Get("Location"), state
+}
+
+// finishOIDC calls back with code and state, presenting cookie as the state
+// cookie, and returns the response and the error reported to the app.
+func (e *testEnv) finishOIDC(t *testing.T, code, state, cookie string) (*httptest.ResponseRecorder, string) {
+	t.Helper()
+	q := url.Values{"code": {code}, "state": {state}}
+	w := e.do(t, http.MethodGet, "/auth/oidc/test/callback?"+q.Encode(), nil, "Cookie", oidcStateCookie+"="+cookie)
+	wantStatus(t, w, http.StatusFound)
+	target, err := url.Parse(w.Header().Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(target.String(), e.cfg.AppURL+"/oidc/callback") {
+		t.Fatalf("redirected to %s", target)
+	}
+	return w, target.Query().Get("error")
+}
+
+func TestOIDCEmailVerified(t *testing.T) {
+	iss := newStubIssuer(t)
+	cases := []struct {
+		name     string
+		verified interface{}
+		want     string
+	}{
+		{"bool", true, ""},
+		{"string", "true", ""},
+		{"false", false, "email_not_verified"},
+		{"string false", "false", "email_not_verified"},
+		{"missing", nil, "email_not_verified"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			e := newOIDCEnv(t, iss)
+			location, state := e.beginOIDC(t)
+			code := iss.grant(t, location, jwt.MapClaims{"email_verified": tc.verified})
+			w, got := e.finishOIDC(t, code, state, state)
+			if got != tc.want {
+				t.Fatalf("error = %q, want %q", got, tc.want)
+			}
+			u, err := e.users.FindByEmail("ana@example.com")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tc.want != "" {
+				if u != nil {
+					t.Errorf("account created for an unverified address")
+				}
+				return
+			}
+			if u == nil || !u.IsVerified {
+				t.Fatalf("account not created verified: %+v", u)
+			}
+			refreshCookie(t, w)
+			ident, err := e.users.FindIdentity("test", "subject-1")
+			if err != nil || ident == nil || ident.UserID != u.ID {
+				t.Errorf("identity not linked: %+v, %v", ident, err)
+			}
+		})
+	}
+}
+
+func TestOIDCClaimUnverified(t *testing.T) {
+	iss := newStubIssuer(t)
+	e := newOIDCEnv(t, iss)
+	u := e.createUser(t, "ana@example.com", "old-password-1")
+	if err := e.db.Model(u).Update("is_verified", false).Error; err != nil {
+		t.Fatal(err)
+	}
+	w := e.do(t, http.MethodPost, "/auth/login", loginReq{Email: "ana@example.com", Password: "old-password-1"})
+	wantStatus(t, w, http.StatusOK)
+	squatter := refreshCookie(t, w)
+
+	location, state := e.beginOIDC(t)
+	w, errCode := e.finishOIDC(t, iss.grant(t, location, nil), state, state)
+	if errCode != "" {
+		t.Fatalf("error = %q", errCode)
+	}
+	refreshCookie(t, w)
+
+	claimed, err := e.users.FindByID(u.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !claimed.IsVerified || claimed.Password != "" {
+		t.Errorf("account not claimed: verified %v, password kept %v", claimed.IsVerified, claimed.Password != "")
+	}
+	// whoever registered the address is signed out and cannot sign back in
+	w = e.do(t, http.MethodPost, "/auth/refresh", nil, "Cookie", RefreshCookieName+"="+squatter)
+	wantStatus(t, w, http.StatusUnauthorized)
+	w = e.do(t, http.MethodPost, "/auth/login", loginReq{Email: "ana@example.com", Password: "old-password-1"})
+	wantStatus(t, w, http.StatusUnauthorized)
+	var live int64
+	e.db.Model(&models.RefreshToken{}).Where("user_id = ? AND revoked = ?", u.ID, false).Count(&live)
+	if live != 1 {
+		t.Errorf("%d live refresh tokens, want only the new session's", live)
+	}
+}
+
+func TestOIDCCallbackRejects(t *testing.T) {
+	iss := newStubIssuer(t)
+	e := newOIDCEnv(t, iss)
+
+	t.Run("state mismatch", func(t *testing.T) {
+		location, state := e.beginOIDC(t)
+		_, other := e.beginOIDC(t)
+		code := iss.grant(t, location, nil)
+		if _, got := e.finishOIDC(t, code, state, other); got != "invalid_state" {
+			t.Errorf("error = %q, want invalid_state", got)
+		}
+		if _, got := e.finishOIDC(t, code, state, ""); got != "invalid_state" {
+			t.Errorf("no cookie: error = %q, want invalid_state", got)
+		}
+	})
+	t.Run("verifier mismatch", func(t *testing.T) {
+		// a code issued to one login redeemed by another
+		location, _ := e.beginOIDC(t)
+		_, state := e.beginOIDC(t)
+		code := iss.grant(t, location, nil)
+		if _, got := e.finishOIDC(t, code, state, state); got != "exchange_failed" {
+			t.Errorf("error = %q, want exchange_failed", got)
+		}
+	})
+	t.Run("nonce mismatch", func(t *testing.T) {
+		location, state := e.beginOIDC(t)
+		code := iss.grant(t, location, jwt.MapClaims{"nonce": "replayed"})
+		if _, got := e.finishOIDC(t, code, state, state); got != "invalid_id_token" {
+			t.Errorf("error = %q, want invalid_id_token", got)
+		}
+	})
+	if u, _ := e.users.FindByEmail("ana@example.com"); u != nil {
+		t.Errorf("rejected callbacks created an account")
+	}
+}
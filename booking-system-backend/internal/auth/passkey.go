@@ -0,0 +1,380 @@
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/redis/go-redis/v9"
+
+	"github.com/temu-in/temu.in/booking-system-backend/internal/config"
+	"github.com/temu-in/temu.in/booking-system-backend/internal/models"
+)
+
+const (
+	EventPasskeyAdded        = "passkey_added"
+	EventPasskeyRemoved      = "passkey_removed"
+	EventPasskeyCloneWarning = "passkey_clone_warning"
+
+	ceremonyPasskeyRegister = "passkey_register"
+	ceremonyPasskeyLogin    = "passkey_login"
+)
+
+// Passkeys runs WebAuthn ceremonies for passwordless login. Passkeys are
+// discoverable credentials with user verification, so a passkey login counts
+// as multi-factor on its own.
+type Passkeys struct {
+	webauthn   *webauthn.WebAuthn
+	ceremonies *ceremonyStore
+	timeout    time.Duration
+}
+
+// NewPasskeys configures the relying party from the WEBAUTHN_* settings. cache
+// may be nil on a single instance.
+func NewPasskeys(cfg *config.Config, cache *redis.Client) (*Passkeys, error) {
+	rpID := cfg.WebAuthnRPID
+	origins := cfg.WebAuthnOrigins
+	if rpID == "" || len(origins) == 0 {
+		u, err := url.Parse(cfg.AppURL)
+		if err != nil || u.Hostname() == "" {
+			return nil, fmt.Errorf("derive webauthn relying party from APP_URL %q", cfg.AppURL)
+		}
+		if rpID == "" {
+			rpID = u.Hostname()
+		}
+		if len(origins) == 0 {
+			origins = []string{u.Scheme + "://" + u.Host}
+		}
+	}
+	timeout := webauthn.TimeoutConfig{Enforce: true, Timeout: cfg.WebAuthnTimeout, TimeoutUVD: cfg.WebAuthnTimeout}
+	wa, err := webauthn.New(&webauthn.Config{
+		RPID:          rpID,
+		RPDisplayName: cfg.WebAuthnRPName,
+		RPOrigins:     origins,
+		AuthenticatorSelection: protocol.AuthenticatorSelection{
+			ResidentKey:        protocol.ResidentKeyRequirementRequired,
+			RequireResidentKey: protocol.ResidentKeyRequired(),
+			UserVerification:   protocol.VerificationRequired,
+		},
+		Timeouts: webauthn.TimeoutsConfig{Login: timeout, Registration: timeout},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &Passkeys{webauthn: wa, ceremonies: newCeremonyStore(cache), timeout: cfg.WebAuthnTimeout}, nil
+}
+
+// WithPasskeys enables passkey registration and login.
+func WithPasskeys(p *Passkeys) Option {
+	return func(h *Handler) { h.passkeys = p }
+}
+
+// passkeyUser adapts a user and their stored passkeys to webauthn.User.
+type passkeyUser struct {
+	u    *models.User
+	keys []models.Passkey
+}
+
+// passkeyUserHandle is the WebAuthn user handle for a user id. It is opaque to
+// authenticators and carries no personal data.
+func passkeyUserHandle(id uint) []byte {
+	return []byte(strconv.FormatUint(uint64(id), 10))
+}
+
+func (p *passkeyUser) WebAuthnID() []byte   { return passkeyUserHandle(p.u.ID) }
+func (p *passkeyUser) WebAuthnName() string { return p.u.Email }
+
+func (p *passkeyUser) WebAuthnDisplayName() string {
+	if p.u.Name != "" {
+		return p.u.Name
+	}
+	return p.u.Email
+}
+
+func (p *passkeyUser) WebAuthnCredentials() []webauthn.Credential {
+	out := make([]webauthn.Credential, len(p.keys))
+	for i, k := range p.keys {
+		var transports []protocol.AuthenticatorTransport
+		for _, t := range strings.Fields(k.Transports) {
+			transports = append(transports, protocol.AuthenticatorTransport(t))
+		}
+		out[i] = webauthn.Credential{
+			ID:              k.CredentialID,
+			PublicKey:       k.PublicKey,
+			AttestationType: k.AttestationType,
+			Transport:       transports,
+			Flags:           webauthn.CredentialFlags{BackupEligible: k.BackupEligible, BackupState: k.BackupState},
+			Authenticator:   webauthn.Authenticator{AAGUID: k.AAGUID, SignCount: k.SignCount, CloneWarning: k.CloneWarning},
+		}
+	}
+	return out
+}
+
+// passkeyRegistration is what the store keeps between the two registration
+// requests.
+type passkeyRegistration struct {
+	UserID  uint                 `json:"user_id"`
+	Session webauthn.SessionData `json:"session"`
+}
+
+// RegisterPasskeyRoutes mounts passkey management under /api/me; rg must
+// already require an interactive session. It does nothing unless passkeys are
+// enabled.
+func (h *Handler) RegisterPasskeyRoutes(rg *gin.RouterGroup) {
+	if h.passkeys == nil {
+		return
+	}
+	rg.GET("/passkeys", h.ListPasskeys)
+	rg.POST("/passkeys/register/begin", h.BeginPasskeyRegistration)
+	rg.POST("/passkeys/register/finish", h.FinishPasskeyRegistration)
+	rg.DELETE("/passkeys/:id", h.DeletePasskey)
+}
+
+func (h *Handler) ListPasskeys(c *gin.Context) {
+	claims, ok := claimsFrom(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthenticated"})
+		return
+	}
+	keys, err := h.repo.ListPasskeys(claims.UserID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"passkeys": keys})
+}
+
+// BeginPasskeyRegistration returns the options for navigator.credentials.create
+// and a session_id to send back with the result.
+func (h *Handler) BeginPasskeyRegistration(c *gin.Context) {
+	u, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+	keys, err := h.repo.ListPasskeys(u.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal"})
+		return
+	}
+	pu := &passkeyUser{u: u, keys: keys}
+	// the authenticator refuses to register a second passkey for the account
+	exclude := webauthn.Credentials(pu.WebAuthnCredentials()).CredentialDescriptors()
+	creation, session, err := h.passkeys.webauthn.BeginRegistration(pu, webauthn.WithExclusions(exclude))
+	if err != nil {
+		log.Printf("passkey registration for user %d: %v", u.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal"})
+		return
+	}
+	id, err := h.passkeys.ceremonies.put(c.Request.Context(), ceremonyPasskeyRegister, passkeyRegistration{UserID: u.ID, Session: *session}, h.passkeys.timeout)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"session_id": id, "options": creation})
+}
+
+type finishPasskeyRegistrationReq struct {
+	SessionID string `json:"session_id" binding:"required"`
+	Name      string `json:"name" binding:"max=100"`
+	// Credential is the PublicKeyCredential returned by the browser.
+	Credential json.RawMessage `json:"credential" binding:"required"`
+}
+
+// FinishPasskeyRegistration verifies the attestation and stores the passkey.
+func (h *Handler) FinishPasskeyRegistration(c *gin.Context) {
+	var req finishPasskeyRegistrationReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	u, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+
+	var reg passkeyRegistration
+	found, err := h.passkeys.ceremonies.take(c.Request.Context(), ceremonyPasskeyRegister, req.SessionID, &reg)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal"})
+		return
+	}
+	if !found || reg.UserID != u.ID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid or expired session"})
+		return
+	}
+
+	parsed, err := protocol.ParseCredentialCreationResponseBytes(req.Credential)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid credential"})
+		return
+	}
+	cred, err := h.passkeys.webauthn.CreateCredential(&passkeyUser{u: u}, reg.Session, parsed)
+	if err != nil {
+		log.Printf("passkey registration for user %d: %v", u.ID, passkeyErrorInfo(err))
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid credential"})
+		return
+	}
+	existing, err := h.repo.FindPasskeyByCredentialID(cred.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal"})
+		return
+	}
+	if existing != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "passkey already registered"})
+		return
+	}
+
+	transports := make([]string, len(cred.Transport))
+	for i, t := range cred.Transport {
+		transports[i] = string(t)
+	}
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		name = "Passkey"
+	}
+	rec := &models.Passkey{
+		UserID: u.ID, Name: name, CredentialID: cred.ID, PublicKey: cred.PublicKey,
+		AttestationType: cred.AttestationType, AAGUID: cred.Authenticator.AAGUID, SignCount: cred.Authenticator.SignCount,
+		Transports: strings.Join(transports, " "), BackupEligible: cred.Flags.BackupEligible, BackupState: cred.Flags.BackupState,
+	}
+	if err := h.repo.CreatePasskey(rec); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed"})
+		return
+	}
+	h.securityEvent(c, EventPasskeyAdded, u.ID, fmt.Sprintf("passkey=%d", rec.ID))
+
+	c.JSON(http.StatusCreated, gin.H{"passkey": rec})
+}
+
+func (h *Handler) DeletePasskey(c *gin.Context) {
+	claims, ok := claimsFrom(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthenticated"})
+		return
+	}
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	found, err := h.repo.DeletePasskey(claims.UserID, uint(id))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed"})
+		return
+	}
+	if !found {
+		c.JSON(http.StatusNotFound, gin.H{"error": "passkey not found"})
+		return
+	}
+	h.securityEvent(c, EventPasskeyRemoved, claims.UserID, fmt.Sprintf("passkey=%d", id))
+	c.JSON(http.StatusOK, gin.H{"status": "deleted"})
+}
+
+// BeginPasskeyLogin returns the options for navigator.credentials.get. No
+// account is named: the authenticator offers the passkeys it holds for the
+// site.
+func (h *Handler) BeginPasskeyLogin(c *gin.Context) {
+	assertion, session, err := h.passkeys.webauthn.BeginDiscoverableLogin(webauthn.WithUserVerification(protocol.VerificationRequired))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal"})
+		return
+	}
+	id, err := h.passkeys.ceremonies.put(c.Request.Context(), ceremonyPasskeyLogin, session, h.passkeys.timeout)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"session_id": id, "options": assertion})
+}
+
+type finishPasskeyLoginReq struct {
+	SessionID  string          `json:"session_id" binding:"required"`
+	Credential json.RawMessage `json:"credential" binding:"required"`
+	RememberMe bool            `json:"remember_me"`
+}
+
+// FinishPasskeyLogin verifies the assertion and starts a session like a
+// password login followed by 2FA would.
+func (h *Handler) FinishPasskeyLogin(c *gin.Context) {
+	var req finishPasskeyLoginReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var session webauthn.SessionData
+	found, err := h.passkeys.ceremonies.take(c.Request.Context(), ceremonyPasskeyLogin, req.SessionID, &session)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal"})
+		return
+	}
+	if !found {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid or expired session"})
+		return
+	}
+	parsed, err := protocol.ParseCredentialRequestResponseBytes(req.Credential)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid credential"})
+		return
+	}
+
+	var key *models.Passkey
+	var u *models.User
+	lookup := func(rawID, userHandle []byte) (webauthn.User, error) {
+		var err error
+		if key, err = h.repo.FindPasskeyByCredentialID(rawID); err != nil {
+			return nil, err
+		}
+		if key == nil || string(userHandle) != string(passkeyUserHandle(key.UserID)) {
+			return nil, errors.New("unknown passkey")
+		}
+		if u, err = h.repo.FindByID(key.UserID); err != nil {
+			return nil, err
+		}
+		return &passkeyUser{u: u, keys: []models.Passkey{*key}}, nil
+	}
+	_, cred, err := h.passkeys.webauthn.ValidatePasskeyLogin(lookup, session, parsed)
+	if err != nil {
+		log.Printf("passkey login: %v", passkeyErrorInfo(err))
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid credentials"})
+		return
+	}
+
+	if cred.Authenticator.CloneWarning {
+		// the counter went backwards: two copies of the key may be in use
+		_ = h.repo.UpdatePasskeyUse(key.ID, key.SignCount, true, cred.Flags.BackupState)
+		h.securityEvent(c, EventPasskeyCloneWarning, u.ID, fmt.Sprintf("passkey=%d stored=%d got=%d", key.ID, key.SignCount, parsed.Response.AuthenticatorData.Counter))
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid credentials"})
+		return
+	}
+	if err := h.repo.UpdatePasskeyUse(key.ID, cred.Authenticator.SignCount, false, cred.Flags.BackupState); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal"})
+		return
+	}
+
+	if !u.IsVerified && h.config.UnverifiedPolicy == config.UnverifiedBlockLogin {
+		c.JSON(http.StatusForbidden, gin.H{"error": "email not verified"})
+		return
+	}
+
+	h.startSession(c, u, req.RememberMe, AMRPasskey, AMRMFA)
+}
+
+// passkeyErrorInfo adds the developer detail protocol errors keep out of
+// Error().
+func passkeyErrorInfo(err error) string {
+	var perr *protocol.Error
+	if errors.As(err, &perr) && perr.DevInfo != "" {
+		return fmt.Sprintf("%v (%s)", err, perr.DevInfo)
+	}
+	return err.Error()
+}
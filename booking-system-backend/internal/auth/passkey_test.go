@@ -0,0 +1,94 @@
+package auth
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/descope/virtualwebauthn"
+
+	"github.com/temu-in/temu.in/booking-system-backend/internal/models"
+)
+
+// ceremony is the response of a begin endpoint.
+type ceremony struct {
+	SessionID string          `json:"session_id"`
+	Options   json.RawMessage `json:"options"`
+}
+
+func beginCeremony(t *testing.T, e *testEnv, path string, header ...string) ceremony {
+	t.Helper()
+	w := e.do(t, http.MethodPost, path, nil, header...)
+	wantStatus(t, w, http.StatusOK)
+	var out ceremony
+	if err := json.Unmarshal(w.Body.Bytes(), &out); err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+func TestPasskeys(t *testing.T) {
+	cfg := testConfig(t)
+	passkeys, err := NewPasskeys(cfg, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := newTestEnv(t, cfg, WithPasskeys(passkeys))
+	e.h.RegisterPasskeyRoutes(e.router.Group("/me", Middleware(e.keys), RequireSession()))
+	u := e.createUser(t, "ana@example.com", "old-password-1")
+
+	rp := virtualwebauthn.RelyingParty{ID: "localhost", Name: cfg.WebAuthnRPName, Origin: "http://localhost:5173"}
+	authenticator := virtualwebauthn.NewAuthenticatorWithOptions(virtualwebauthn.AuthenticatorOptions{UserHandle: passkeyUserHandle(u.ID)})
+	cred := virtualwebauthn.NewCredential(virtualwebauthn.KeyTypeEC2)
+
+	// register
+	reg := beginCeremony(t, e, "/me/passkeys/register/begin", e.bearer(t, u)...)
+	attOpts, err := virtualwebauthn.ParseAttestationOptions(string(reg.Options))
+	if err != nil {
+		t.Fatal(err)
+	}
+	attestation := virtualwebauthn.CreateAttestationResponse(rp, authenticator, cred, *attOpts)
+	w := e.do(t, http.MethodPost, "/me/passkeys/register/finish", finishPasskeyRegistrationReq{SessionID: reg.SessionID, Name: "laptop", Credential: json.RawMessage(attestation)}, e.bearer(t, u)...)
+	wantStatus(t, w, http.StatusCreated)
+	authenticator.AddCredential(cred)
+
+	// a second finish with the same ceremony is refused
+	w = e.do(t, http.MethodPost, "/me/passkeys/register/finish", finishPasskeyRegistrationReq{SessionID: reg.SessionID, Credential: json.RawMessage(attestation)}, e.bearer(t, u)...)
+	wantStatus(t, w, http.StatusBadRequest)
+
+	login := func(counter uint32) *httptest.ResponseRecorder {
+		begin := beginCeremony(t, e, "/auth/passkeys/login/begin")
+		opts, err := virtualwebauthn.ParseAssertionOptions(string(begin.Options))
+		if err != nil {
+			t.Fatal(err)
+		}
+		cred.Counter = counter
+		assertion := virtualwebauthn.CreateAssertionResponse(rp, authenticator, cred, *opts)
+		return e.do(t, http.MethodPost, "/auth/passkeys/login/finish", finishPasskeyLoginReq{SessionID: begin.SessionID, Credential: json.RawMessage(assertion)})
+	}
+	stored := func() models.Passkey {
+		var k models.Passkey
+		if err := e.db.Where("user_id = ?", u.ID).First(&k).Error; err != nil {
+			t.Fatal(err)
+		}
+		return k
+	}
+
+	// login advances the sign count
+	w = login(5)
+	wantStatus(t, w, http.StatusOK)
+	if body := decode(t, w); body["token"] == nil {
+		t.Errorf("no access token in %v", body)
+	}
+	if k := stored(); k.SignCount != 5 || k.CloneWarning {
+		t.Errorf("after login: sign count %d, clone warning %v", k.SignCount, k.CloneWarning)
+	}
+	wantStatus(t, login(6), http.StatusOK)
+
+	// a counter that went backwards means a cloned key
+	wantStatus(t, login(3), http.StatusUnauthorized)
+	if k := stored(); k.SignCount != 6 || !k.CloneWarning {
+		t.Errorf("after clone: sign count %d, clone warning %v", k.SignCount, k.CloneWarning)
+	}
+}
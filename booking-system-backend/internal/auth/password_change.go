@@ -0,0 +1,99 @@
+package auth
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/temu-in/temu.in/booking-system-backend/internal/models"
+	"github.com/temu-in/temu.in/booking-system-backend/internal/password"
+)
+
+const EventPasswordChanged = "password_changed"
+
+// acceptablePassword checks pw against the password policy for u and, when it
+// is rejected, answers 400 with the reasons in the client's language.
+func (h *Handler) acceptablePassword(c *gin.Context, pw string, u *models.User) bool {
+	reasons := h.policy.Check(pw, password.Locale(c.GetHeader("Accept-Language")), u.Email, u.Name)
+	if len(reasons) == 0 {
+		return true
+	}
+	c.JSON(http.StatusBadRequest, gin.H{"error": "weak password", "reasons": reasons})
+	return false
+}
+
+type changePasswordReq struct {
+	CurrentPassword string `json:"current_password" binding:"required"`
+	NewPassword     string `json:"new_password" binding:"required"`
+}
+
+// ChangePassword replaces the caller's password after re-checking the current
+// one. Every other session is signed out; the one making the request stays and
+// receives a new access token.
+func (h *Handler) ChangePassword(c *gin.Context) {
+	var req changePasswordReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	claims, ok := claimsFrom(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthenticated"})
+		return
+	}
+	u, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+
+	if ok, _ := h.hasher.Verify(req.CurrentPassword, u.Password); !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid credentials"})
+		return
+	}
+	if !h.acceptablePassword(c, req.NewPassword, u) {
+		return
+	}
+
+	pw, err := h.hasher.Hash(req.NewPassword)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal"})
+		return
+	}
+	if err := h.repo.UpdatePassword(u.ID, pw); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed"})
+		return
+	}
+
+	sessions, err := h.tokens.ListActiveSessions(u.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed"})
+		return
+	}
+	for _, s := range sessions {
+		if s.FamilyID == "" || s.FamilyID == claims.SessionID {
+			continue
+		}
+		if _, err := h.tokens.RevokeSession(u.ID, s.FamilyID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed"})
+			return
+		}
+		if h.denylist != nil {
+			h.denylist.RevokeSession(c.Request.Context(), s.FamilyID)
+		}
+	}
+	h.securityEvent(c, EventPasswordChanged, u.ID, "")
+
+	// the change bumped the security version, retiring the caller's access
+	// token as well; hand out a new one for the session that stays
+	version, err := h.repo.SecurityVersion(u.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal"})
+		return
+	}
+	tok, err := NewToken(h.keys, &Claims{UserID: u.ID, Role: u.Role, AMR: claims.AMR, SessionID: claims.SessionID, Version: version, Verified: u.IsVerified}, h.config.AccessTokenTTL)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "token"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "password_changed", "token": tok})
+}
@@ -0,0 +1,144 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+
+	"github.com/temu-in/temu.in/booking-system-backend/internal/mail"
+	"github.com/temu-in/temu.in/booking-system-backend/internal/models"
+	"github.com/temu-in/temu.in/booking-system-backend/internal/token"
+)
+
+type forgotPasswordReq struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+// NewPasswordResetLimiter allows one reset email per address per cooldown and
+// at most maxPerIP requests per window from one client IP.
+func NewPasswordResetLimiter(cache *redis.Client, cooldown time.Duration, maxPerIP int, window time.Duration) *RequestLimiter {
+	return NewRequestLimiter(cache, "reset:", cooldown, maxPerIP, window)
+}
+
+// WithPasswordResetLimiter rate-limits ForgotPassword.
+func WithPasswordResetLimiter(l *RequestLimiter) Option {
+	return func(h *Handler) { h.resetLimiter = l }
+}
+
+// ForgotPassword emails a single-use reset link. It always answers with the
+// same response, and as fast, so it cannot be used to discover registered
+// addresses: the token and the email are produced after the response.
+func (h *Handler) ForgotPassword(c *gin.Context) {
+	var req forgotPasswordReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if h.resetLimiter != nil {
+		if wait := h.resetLimiter.Allow(c.Request.Context(), req.Email, c.ClientIP()); wait > 0 {
+			tooManyAttempts(c, wait)
+			return
+		}
+	}
+
+	u, err := h.repo.FindByEmail(req.Email)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal"})
+		return
+	}
+	if u != nil {
+		h.background(func(ctx context.Context) {
+			if err := h.sendPasswordReset(ctx, u); err != nil {
+				log.Printf("password reset for user %d: %v", u.ID, err)
+			}
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "reset_requested"})
+}
+
+func (h *Handler) sendPasswordReset(ctx context.Context, u *models.User) error {
+	raw, err := h.issueActionToken(u.ID, token.PurposePasswordReset, h.config.PasswordResetTTL)
+	if err != nil {
+		return err
+	}
+
+	link := fmt.Sprintf("%s/reset-password?token=%s", h.config.AppURL, url.QueryEscape(raw))
+	return h.mailer.Send(ctx, mail.Message{
+		To:      u.Email,
+		Subject: "Reset your temu.in password",
+		Body: fmt.Sprintf("We received a request to reset your password.\n\nOpen this link to choose a new one:\n%s\n\n"+
+			"The link expires in %s. If you did not ask for this, you can ignore this email.", link, h.config.PasswordResetTTL),
+	})
+}
+
+type resetPasswordReq struct {
+	Token    string `json:"token" binding:"required"`
+	Password string `json:"password" binding:"required"`
+}
+
+// ResetPassword consumes a reset token, sets the new password and revokes
+// every refresh token of the user so existing sessions have to log in again.
+func (h *Handler) ResetPassword(c *gin.Context) {
+	var req resetPasswordReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	hash := hashToken(req.Token)
+	pending, err := h.tokens.FindAction(hash, token.PurposePasswordReset)
+	if err != nil {
+		if errors.Is(err, token.ErrActionTokenInvalid) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid or expired token"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal"})
+		return
+	}
+	u, err := h.repo.FindByID(pending.UserID)
+	if err != nil || u == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid or expired token"})
+		return
+	}
+	// check before consuming so a rejected password does not burn the link
+	if !h.acceptablePassword(c, req.Password, u) {
+		return
+	}
+
+	rec, err := h.tokens.ConsumeAction(hash, token.PurposePasswordReset)
+	if err != nil {
+		if errors.Is(err, token.ErrActionTokenInvalid) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid or expired token"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal"})
+		return
+	}
+
+	pw, err := h.hasher.Hash(req.Password)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal"})
+		return
+	}
+	if err := h.repo.UpdatePassword(rec.UserID, pw); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "reset failed"})
+		return
+	}
+	if err := h.tokens.RevokeAllForUser(rec.UserID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "reset failed"})
+		return
+	}
+	if h.denylist != nil {
+		h.denylist.RevokeUser(c.Request.Context(), rec.UserID)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "password_reset"})
+}
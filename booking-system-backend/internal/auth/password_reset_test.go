@@ -0,0 +1,106 @@
+package auth
+
+import (
+	"net/http"
+	"net/url"
+	"regexp"
+	"testing"
+	"time"
+)
+
+var resetLink = regexp.MustCompile(`reset-password\?token=(\S+)`)
+
+// resetToken extracts the token from the last reset email sent to email.
+func resetToken(t *testing.T, e *testEnv, email string) string {
+	t.Helper()
+	e.h.pending.Wait()
+	msg, ok := e.outbox.Last(email)
+	if !ok {
+		t.Fatalf("no email sent to %s", email)
+	}
+	m := resetLink.FindStringSubmatch(msg.Body)
+	if m == nil {
+		t.Fatalf("no reset link in %q", msg.Body)
+	}
+	raw, err := url.QueryUnescape(m[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return raw
+}
+
+func TestPasswordReset(t *testing.T) {
+	e := newTestEnv(t, nil)
+	e.createUser(t, "ana@example.com", "old-password-1")
+
+	w := e.do(t, http.MethodPost, "/auth/forgot-password", forgotPasswordReq{Email: "ana@example.com"})
+	wantStatus(t, w, http.StatusOK)
+	raw := resetToken(t, e, "ana@example.com")
+
+	// a rejected password leaves the link usable
+	w = e.do(t, http.MethodPost, "/auth/reset-password", resetPasswordReq{Token: raw, Password: "short"})
+	wantStatus(t, w, http.StatusBadRequest)
+
+	w = e.do(t, http.MethodPost, "/auth/reset-password", resetPasswordReq{Token: raw, Password: "new-password-42"})
+	wantStatus(t, w, http.StatusOK)
+
+	w = e.do(t, http.MethodPost, "/auth/reset-password", resetPasswordReq{Token: raw, Password: "other-password-42"})
+	wantStatus(t, w, http.StatusBadRequest)
+
+	w = e.do(t, http.MethodPost, "/auth/login", loginReq{Email: "ana@example.com", Password: "old-password-1"})
+	wantStatus(t, w, http.StatusUnauthorized)
+	w = e.do(t, http.MethodPost, "/auth/login", loginReq{Email: "ana@example.com", Password: "new-password-42"})
+	wantStatus(t, w, http.StatusOK)
+}
+
+func TestForgotPasswordUnknownEmail(t *testing.T) {
+	e := newTestEnv(t, nil)
+	e.createUser(t, "ana@example.com", "old-password-1")
+
+	known := e.do(t, http.MethodPost, "/auth/forgot-password", forgotPasswordReq{Email: "ana@example.com"})
+	unknown := e.do(t, http.MethodPost, "/auth/forgot-password", forgotPasswordReq{Email: "bob@example.com"})
+	wantStatus(t, unknown, known.Code)
+	if unknown.Body.String() != known.Body.String() {
+		t.Errorf("unknown email answered %s, known %s", unknown.Body, known.Body)
+	}
+
+	e.h.pending.Wait()
+	if _, ok := e.outbox.Last("bob@example.com"); ok {
+		t.Error("reset email sent to an unknown address")
+	}
+	if n := len(e.outbox.Messages()); n != 1 {
+		t.Errorf("sent %d emails, want 1", n)
+	}
+}
+
+func TestResetPasswordInvalidToken(t *testing.T) {
+	e := newTestEnv(t, nil)
+	w := e.do(t, http.MethodPost, "/auth/reset-password", resetPasswordReq{Token: "bogus", Password: "new-password-42"})
+	wantStatus(t, w, http.StatusBadRequest)
+}
+
+func TestForgotPasswordRateLimit(t *testing.T) {
+	e := newTestEnv(t, nil, WithPasswordResetLimiter(NewPasswordResetLimiter(nil, time.Minute, 3, time.Hour)))
+	e.createUser(t, "ana@example.com", "old-password-1")
+
+	w := e.do(t, http.MethodPost, "/auth/forgot-password", forgotPasswordReq{Email: "ana@example.com"})
+	wantStatus(t, w, http.StatusOK)
+	// one email per address per cooldown, registered or not
+	w = e.do(t, http.MethodPost, "/auth/forgot-password", forgotPasswordReq{Email: "ANA@example.com"})
+	wantStatus(t, w, http.StatusTooManyRequests)
+	if w.Header().Get("Retry-After") == "" {
+		t.Error("no Retry-After header")
+	}
+	e.h.pending.Wait()
+	if n := len(e.outbox.Messages()); n != 1 {
+		t.Errorf("sent %d emails, want 1", n)
+	}
+
+	// the client IP is limited across addresses
+	for _, email := range []string{"b@example.com", "c@example.com"} {
+		w = e.do(t, http.MethodPost, "/auth/forgot-password", forgotPasswordReq{Email: email})
+		wantStatus(t, w, http.StatusOK)
+	}
+	w = e.do(t, http.MethodPost, "/auth/forgot-password", forgotPasswordReq{Email: "d@example.com"})
+	wantStatus(t, w, http.StatusTooManyRequests)
+}
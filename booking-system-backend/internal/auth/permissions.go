@@ -0,0 +1,257 @@
+package auth
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/temu-in/temu.in/booking-system-backend/internal/audit"
+	"github.com/temu-in/temu.in/booking-system-backend/internal/config"
+	"github.com/temu-in/temu.in/booking-system-backend/internal/models"
+)
+
+// Permission names an action, as "<resource>:<action>" or, when it is limited
+// to resources the user owns, "<resource>:<action>:own".
+type Permission string
+
+const (
+	PermBookingsCreate    Permission = "bookings:create"
+	PermBookingsReadOwn   Permission = "bookings:read:own"
+	PermBookingsReadAny   Permission = "bookings:read"
+	PermBookingsCancelOwn Permission = "bookings:cancel:own"
+	PermBookingsCancelAny Permission = "bookings:cancel"
+	PermServicesWriteOwn  Permission = "services:write:own"
+	PermServicesWriteAny  Permission = "services:write"
+	PermPaymentsRefund    Permission = "payments:refund"
+	PermUsersReadOwn      Permission = "users:read:own"
+	PermUsersRead         Permission = "users:read"
+	PermUsersManage       Permission = "users:manage"
+	PermUsersRoles        Permission = "users:roles"
+	PermUsersImpersonate  Permission = "users:impersonate"
+	PermAuditRead         Permission = "audit:read"
+
+	// PermAll grants every permission.
+	PermAll Permission = "*"
+)
+
+// Permissions lists every permission a role may be granted.
+var Permissions = []Permission{
+	PermBookingsCreate, PermBookingsReadOwn, PermBookingsReadAny, PermBookingsCancelOwn, PermBookingsCancelAny,
+	PermServicesWriteOwn, PermServicesWriteAny, PermPaymentsRefund,
+	PermUsersReadOwn, PermUsersRead, PermUsersManage, PermUsersRoles, PermUsersImpersonate, PermAuditRead,
+}
+
+// notWhileImpersonating are never granted to impersonation tokens, whatever
+// the impersonated role allows.
+var notWhileImpersonating = []Permission{PermUsersManage, PermUsersRoles, PermUsersImpersonate, PermPaymentsRefund}
+
+const (
+	EventPermissionDenied = "permission_denied"
+)
+
+// RolePolicy maps each role to the permissions it grants.
+type RolePolicy struct {
+	grants map[models.Role][]Permission
+}
+
+// NewRolePolicy validates grants and builds a policy from it. Roles left out
+// grant nothing.
+func NewRolePolicy(grants map[models.Role][]Permission) (*RolePolicy, error) {
+	p := &RolePolicy{grants: map[models.Role][]Permission{}}
+	for role, perms := range grants {
+		if !role.Valid() {
+			return nil, fmt.Errorf("unknown role %q", role)
+		}
+		for _, perm := range perms {
+			if perm != PermAll && !slices.Contains(Permissions, perm) {
+				return nil, fmt.Errorf("role %s: unknown permission %q", role, perm)
+			}
+		}
+		p.grants[role] = slices.Clone(perms)
+	}
+	return p, nil
+}
+
+// DefaultRolePolicy is the built-in mapping used unless AUTHZ_POLICY_FILE is
+// set.
+func DefaultRolePolicy() *RolePolicy {
+	customer := []Permission{PermBookingsCreate, PermBookingsReadOwn, PermBookingsCancelOwn, PermUsersReadOwn}
+	p, err := NewRolePolicy(map[models.Role][]Permission{
+		models.RoleCustomer: customer,
+		models.RoleProvider: append(slices.Clone(customer), PermServicesWriteOwn),
+		models.RoleSupport:  {PermUsersRead, PermUsersManage, PermUsersImpersonate, PermBookingsReadAny, PermBookingsCancelAny},
+		models.RoleFinance:  {PermBookingsReadAny, PermPaymentsRefund, PermAuditRead},
+		models.RoleAdmin:    {PermAll},
+	})
+	if err != nil {
+		panic(err)
+	}
+	return p
+}
+
+// LoadRolePolicy reads a JSON object mapping role names to permission lists,
+// e.g. {"support": ["users:read", "users:manage"], "admin": ["*"]}. The file
+// replaces the built-in mapping entirely.
+func LoadRolePolicy(path string) (*RolePolicy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var grants map[models.Role][]Permission
+	if err := json.Unmarshal(data, &grants); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	return NewRolePolicy(grants)
+}
+
+// RolePolicyFromConfig loads AUTHZ_POLICY_FILE, or returns the built-in
+// policy when it is not set.
+func RolePolicyFromConfig(cfg *config.Config) (*RolePolicy, error) {
+	if cfg.AuthzPolicyFile == "" {
+		return DefaultRolePolicy(), nil
+	}
+	return LoadRolePolicy(cfg.AuthzPolicyFile)
+}
+
+// Allows reports whether role grants perm.
+func (p *RolePolicy) Allows(role models.Role, perm Permission) bool {
+	perms := p.grants[role]
+	return slices.Contains(perms, PermAll) || slices.Contains(perms, perm)
+}
+
+// Authorizer enforces a RolePolicy on requests that passed Middleware and
+// audits every denial.
+type Authorizer struct {
+	policy *RolePolicy
+	audit  *audit.Repository // optional
+}
+
+func NewAuthorizer(policy *RolePolicy, auditRepo *audit.Repository) *Authorizer {
+	return &Authorizer{policy: policy, audit: auditRepo}
+}
+
+// Can reports whether the caller holds perm, recording a denial if not.
+func (a *Authorizer) Can(c *gin.Context, perm Permission) bool {
+	claims, ok := claimsFrom(c)
+	if !ok {
+		return false
+	}
+	if a.allows(claims, perm) {
+		return true
+	}
+	a.denied(c, claims, fmt.Sprintf("perm=%s", perm))
+	return false
+}
+
+// allows applies the policy to claims, withholding notWhileImpersonating
+// from impersonation tokens.
+func (a *Authorizer) allows(claims *Claims, perm Permission) bool {
+	if claims.IsImpersonation() && slices.Contains(notWhileImpersonating, perm) {
+		return false
+	}
+	return a.policy.Allows(claims.Role, perm)
+}
+
+// CanAccess decides access to a resource owned by ownerID: callers holding
+// all are always allowed, callers holding own only when they are the owner.
+func (a *Authorizer) CanAccess(c *gin.Context, own, all Permission, ownerID uint) bool {
+	claims, ok := claimsFrom(c)
+	if !ok {
+		return false
+	}
+	if a.allows(claims, all) {
+		return true
+	}
+	if a.allows(claims, own) && ownerID != 0 && ownerID == claims.UserID {
+		return true
+	}
+	a.denied(c, claims, fmt.Sprintf("perm=%s owner=%d", own, ownerID))
+	return false
+}
+
+// RequirePermission aborts with 403 unless the caller's role grants perm.
+func (a *Authorizer) RequirePermission(perm Permission) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !a.Can(c, perm) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "forbidden"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// OwnerFunc returns the id of the user owning the resource a request
+// addresses. found is false when the resource does not exist.
+type OwnerFunc func(c *gin.Context) (ownerID uint, found bool, err error)
+
+// UserIDParam is the OwnerFunc for routes on a user account itself: the owner
+// is the user whose id is in the path parameter name.
+func UserIDParam(name string) OwnerFunc {
+	return func(c *gin.Context) (uint, bool, error) {
+		id, err := strconv.ParseUint(c.Param(name), 10, 64)
+		if err != nil || id == 0 {
+			return 0, false, nil
+		}
+		return uint(id), true, nil
+	}
+}
+
+// RequireOwnership guards routes on a single resource, e.g. a provider's
+// service: callers need all, or own and to be the resource's owner.
+func (a *Authorizer) RequireOwnership(own, all Permission, owner OwnerFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ownerID, found, err := owner(c)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "internal"})
+			return
+		}
+		if !found {
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "not found"})
+			return
+		}
+		if !a.CanAccess(c, own, all, ownerID) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "forbidden"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// RequireStaff admits only staff roles. It fronts the admin API so that other
+// checks on it, such as RequireMFA, only ever see staff.
+func (a *Authorizer) RequireStaff() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, ok := claimsFrom(c)
+		if !ok {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "missing claims"})
+			return
+		}
+		if !claims.Role.IsStaff() {
+			a.denied(c, claims, "staff only")
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "forbidden"})
+			return
+		}
+		c.Next()
+	}
+}
+
+func (a *Authorizer) denied(c *gin.Context, claims *Claims, details string) {
+	details = fmt.Sprintf("%s role=%s %s %s", details, claims.Role, c.Request.Method, c.Request.URL.Path)
+	if claims.IsImpersonation() {
+		details += fmt.Sprintf(" actor=%d", claims.Act.UserID)
+	}
+	log.Printf("security: event=%s user=%d ip=%s %s", EventPermissionDenied, claims.UserID, c.ClientIP(), details)
+	if a.audit == nil {
+		return
+	}
+	e := &models.SecurityEvent{UserID: claims.UserID, Event: EventPermissionDenied, IP: c.ClientIP(), UserAgent: c.Request.UserAgent(), Details: details}
+	if err := a.audit.CreateSecurityEvent(e); err != nil {
+		log.Printf("security: persist event %s: %v", EventPermissionDenied, err)
+	}
+}
@@ -0,0 +1,59 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/temu-in/temu.in/booking-system-backend/internal/models"
+)
+
+func TestRequireOwnership(t *testing.T) {
+	policy, err := NewRolePolicy(map[models.Role][]Permission{
+		models.RoleCustomer: {PermUsersReadOwn},
+		models.RoleProvider: {PermServicesWriteOwn},
+		models.RoleSupport:  {PermUsersRead},
+		// a custom policy lending a customer-facing role a guarded permission
+		models.RoleFinance: {PermUsersManage},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	authz := NewAuthorizer(policy, nil)
+
+	const owner = 7
+	impersonated := &Claims{UserID: owner, Role: models.RoleFinance, Act: &Actor{UserID: 1, Role: models.RoleAdmin}}
+	cases := []struct {
+		name     string
+		claims   *Claims
+		own, all Permission
+		path     string
+		want     int
+	}{
+		{"owner", &Claims{UserID: owner, Role: models.RoleCustomer}, PermUsersReadOwn, PermUsersRead, "/7", http.StatusOK},
+		{"someone else", &Claims{UserID: 8, Role: models.RoleCustomer}, PermUsersReadOwn, PermUsersRead, "/7", http.StatusForbidden},
+		{"any", &Claims{UserID: 2, Role: models.RoleSupport}, PermUsersReadOwn, PermUsersRead, "/7", http.StatusOK},
+		{"wrong own permission", &Claims{UserID: owner, Role: models.RoleProvider}, PermUsersReadOwn, PermUsersRead, "/7", http.StatusForbidden},
+		{"not found", &Claims{UserID: owner, Role: models.RoleCustomer}, PermUsersReadOwn, PermUsersRead, "/x", http.StatusNotFound},
+		{"session", &Claims{UserID: 2, Role: models.RoleFinance}, PermUsersReadOwn, PermUsersManage, "/7", http.StatusOK},
+		{"impersonating", impersonated, PermUsersReadOwn, PermUsersManage, "/9", http.StatusForbidden},
+		{"impersonating own", impersonated, PermUsersManage, PermUsersRead, "/7", http.StatusForbidden},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := gin.New()
+			r.GET("/:id", func(c *gin.Context) {
+				c.Set(UserContextKey, tc.claims)
+			}, authz.RequireOwnership(tc.own, tc.all, UserIDParam("id")), func(c *gin.Context) {
+				c.Status(http.StatusOK)
+			})
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tc.path, nil))
+			if w.Code != tc.want {
+				t.Errorf("status = %d, want %d", w.Code, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,53 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/temu-in/temu.in/booking-system-backend/internal/models"
+)
+
+// refreshCookie returns the refresh token set by a response.
+func refreshCookie(t *testing.T, w *httptest.ResponseRecorder) string {
+	t.Helper()
+	for _, ck := range w.Result().Cookies() {
+		if ck.Name == RefreshCookieName && ck.Value != "" {
+			return ck.Value
+		}
+	}
+	t.Fatalf("no refresh cookie in %v", w.Header())
+	return ""
+}
+
+func TestRefreshReuse(t *testing.T) {
+	e := newTestEnv(t, nil)
+	e.createUser(t, "ana@example.com", "old-password-1")
+	w := e.do(t, http.MethodPost, "/auth/login", loginReq{Email: "ana@example.com", Password: "old-password-1"})
+	wantStatus(t, w, http.StatusOK)
+	first := refreshCookie(t, w)
+
+	refresh := func(rt string) *httptest.ResponseRecorder {
+		return e.do(t, http.MethodPost, "/auth/refresh", nil, "Cookie", RefreshCookieName+"="+rt)
+	}
+	w = refresh(first)
+	wantStatus(t, w, http.StatusOK)
+	second := refreshCookie(t, w)
+
+	// another tab refreshing with the same cookie moments later
+	wantStatus(t, refresh(first), http.StatusConflict)
+	wantStatus(t, refresh(second), http.StatusOK)
+
+	// the same replay after the grace period revokes the session
+	past := time.Now().Add(-time.Minute)
+	if err := e.db.Model(&models.RefreshToken{}).Where("rotated = ?", true).Update("rotated_at", past).Error; err != nil {
+		t.Fatal(err)
+	}
+	wantStatus(t, refresh(first), http.StatusUnauthorized)
+	var live int64
+	e.db.Model(&models.RefreshToken{}).Where("revoked = ?", false).Count(&live)
+	if live != 0 {
+		t.Errorf("%d refresh tokens still live after reuse", live)
+	}
+}
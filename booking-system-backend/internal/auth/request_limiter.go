@@ -0,0 +1,67 @@
+package auth
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RequestLimiter throttles endpoints that send email on request, such as
+// magic links and password resets: one request per address per cooldown, and
+// at most maxPerIP requests per window from one client IP. Like LoginLimiter
+// it keeps its counters in Redis when available.
+type RequestLimiter struct {
+	store    attemptStore
+	prefix   string
+	cooldown time.Duration
+	maxPerIP int
+	window   time.Duration
+}
+
+// NewRequestLimiter creates a limiter whose keys start with prefix, so
+// limiters for different endpoints do not share counters.
+func NewRequestLimiter(cache *redis.Client, prefix string, cooldown time.Duration, maxPerIP int, window time.Duration) *RequestLimiter {
+	var store attemptStore = newMemoryAttemptStore()
+	if cache != nil {
+		store = &redisAttemptStore{cache: cache}
+	}
+	return &RequestLimiter{store: store, prefix: prefix, cooldown: cooldown, maxPerIP: maxPerIP, window: window}
+}
+
+// Allow records a request and returns how long the caller must wait instead,
+// or zero. The cooldown is keyed on the address as typed, registered or not,
+// so it reveals nothing about accounts. Store errors fail open.
+func (l *RequestLimiter) Allow(ctx context.Context, email, ip string) time.Duration {
+	emailK := l.prefix + emailKey(email)
+	ipK := l.prefix + ipKey(ip)
+	for _, key := range []string{emailK, ipK} {
+		d, err := l.store.lockedFor(ctx, key)
+		if err != nil {
+			log.Printf("request limiter: %v", err)
+			continue
+		}
+		if d > 0 {
+			return d
+		}
+	}
+
+	if l.maxPerIP > 0 {
+		n, err := l.store.incr(ctx, ipK, l.window)
+		if err != nil {
+			log.Printf("request limiter: %v", err)
+		} else if int(n) > l.maxPerIP {
+			if err := l.store.lock(ctx, ipK, l.window); err != nil {
+				log.Printf("request limiter: %v", err)
+			}
+			return l.window
+		}
+	}
+	if l.cooldown > 0 {
+		if err := l.store.lock(ctx, emailK, l.cooldown); err != nil {
+			log.Printf("request limiter: %v", err)
+		}
+	}
+	return 0
+}
@@ -0,0 +1,50 @@
+package auth
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/temu-in/temu.in/booking-system-backend/internal/models"
+)
+
+const (
+	EventRefreshTokenReuse = "refresh_token_reuse"
+	EventLoginLockout      = "login_lockout"
+)
+
+// securityEvent logs an authentication incident and persists it when an audit
+// repository is configured.
+func (h *Handler) securityEvent(c *gin.Context, event string, userID uint, details string) {
+	log.Printf("security: event=%s user=%d ip=%s %s", event, userID, c.ClientIP(), details)
+	if h.audit == nil {
+		return
+	}
+	e := &models.SecurityEvent{UserID: userID, Event: event, IP: c.ClientIP(), UserAgent: c.Request.UserAgent(), Details: details}
+	if err := h.audit.CreateSecurityEvent(e); err != nil {
+		log.Printf("security: persist event %s: %v", event, err)
+	}
+}
+
+// loginFailed answers a failed login, recording it with the limiter. When the
+// failure trips a lockout the client gets 429 instead of 401.
+func (h *Handler) loginFailed(c *gin.Context, email string, userID uint) {
+	if h.limiter != nil {
+		if wait := h.limiter.Fail(c.Request.Context(), email, c.ClientIP()); wait > 0 {
+			h.securityEvent(c, EventLoginLockout, userID, fmt.Sprintf("email=%s locked for %s", email, wait.Round(time.Second)))
+			tooManyAttempts(c, wait)
+			return
+		}
+	}
+	c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid credentials"})
+}
+
+func tooManyAttempts(c *gin.Context, wait time.Duration) {
+	c.Header("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	c.JSON(http.StatusTooManyRequests, gin.H{"error": "too many attempts"})
+}
@@ -0,0 +1,128 @@
+package auth
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/temu-in/temu.in/booking-system-backend/internal/config"
+	"github.com/temu-in/temu.in/booking-system-backend/internal/models"
+)
+
+// RefreshCookieName is the cookie carrying the refresh token.
+const RefreshCookieName = "refresh_token"
+
+// SessionPolicy decides how long refresh sessions live and owns the refresh
+// cookie, so every place that sets or clears it agrees on its attributes.
+//
+// A session ends at whichever comes first: IdleTimeout after its last refresh,
+// or its absolute lifetime after login. Rotation moves the idle deadline but
+// never the absolute one.
+type SessionPolicy struct {
+	IdleTimeout time.Duration // 0 disables the idle timeout
+	Lifetime    time.Duration // absolute lifetime of a normal session
+	RememberMe  time.Duration // absolute lifetime of a remember-me session
+
+	Secure   bool
+	SameSite http.SameSite
+	Domain   string
+}
+
+// NewSessionPolicy builds the policy from the environment. Cookies default to
+// Secure and SameSite=Strict in production and SameSite=Lax elsewhere.
+func NewSessionPolicy(cfg *config.Config) *SessionPolicy {
+	p := &SessionPolicy{
+		IdleTimeout: cfg.SessionIdleTimeout,
+		Lifetime:    cfg.SessionLifetime,
+		RememberMe:  cfg.RefreshTokenTTL,
+		Secure:      cfg.AppEnv == "production",
+		SameSite:    http.SameSiteLaxMode,
+		Domain:      cfg.SessionCookieDomain,
+	}
+	if p.Secure {
+		p.SameSite = http.SameSiteStrictMode
+	}
+	switch strings.ToLower(cfg.SessionCookieSameSite) {
+	case "strict":
+		p.SameSite = http.SameSiteStrictMode
+	case "lax":
+		p.SameSite = http.SameSiteLaxMode
+	case "none":
+		// browsers drop SameSite=None cookies that are not Secure
+		p.SameSite = http.SameSiteNoneMode
+		p.Secure = true
+	}
+	return p
+}
+
+// Deadline is the absolute end of a session started at startedAt.
+func (p *SessionPolicy) Deadline(startedAt time.Time, rememberMe bool) time.Time {
+	if rememberMe {
+		return startedAt.Add(p.RememberMe)
+	}
+	return startedAt.Add(p.Lifetime)
+}
+
+// Expiry is when a refresh token issued at now for a session started at
+// startedAt stops being accepted.
+func (p *SessionPolicy) Expiry(startedAt, now time.Time, rememberMe bool) time.Time {
+	exp := p.Deadline(startedAt, rememberMe)
+	if p.IdleTimeout > 0 {
+		if idle := now.Add(p.IdleTimeout); idle.Before(exp) {
+			exp = idle
+		}
+	}
+	return exp
+}
+
+// Valid reports whether rec may still be exchanged for new tokens.
+func (p *SessionPolicy) Valid(rec *models.RefreshToken, now time.Time) bool {
+	if !now.Before(rec.ExpiresAt) {
+		return false
+	}
+	startedAt := rec.StartedAt
+	if startedAt.IsZero() {
+		startedAt = rec.CreatedAt
+	}
+	if !now.Before(p.Deadline(startedAt, rec.RememberMe)) {
+		return false
+	}
+	if p.IdleTimeout > 0 && !rec.LastUsedAt.IsZero() && now.Sub(rec.LastUsedAt) >= p.IdleTimeout {
+		return false
+	}
+	return true
+}
+
+// SetCookie writes the refresh cookie for rec. Remember-me sessions get a
+// persistent cookie; others a browser-session cookie that goes away when the
+// browser is closed.
+func (p *SessionPolicy) SetCookie(c *gin.Context, value string, rec *models.RefreshToken) {
+	cookie := p.cookie(value)
+	if rec.RememberMe {
+		cookie.Expires = rec.ExpiresAt
+		cookie.MaxAge = int(time.Until(rec.ExpiresAt).Seconds())
+	}
+	http.SetCookie(c.Writer, cookie)
+}
+
+// ClearCookie removes the refresh cookie from the browser.
+func (p *SessionPolicy) ClearCookie(c *gin.Context) {
+	cookie := p.cookie("")
+	cookie.Expires = time.Unix(0, 0)
+	cookie.MaxAge = -1
+	http.SetCookie(c.Writer, cookie)
+}
+
+func (p *SessionPolicy) cookie(value string) *http.Cookie {
+	return &http.Cookie{
+		Name:     RefreshCookieName,
+		Value:    value,
+		Path:     "/",
+		Domain:   p.Domain,
+		HttpOnly: true,
+		Secure:   p.Secure,
+		SameSite: p.SameSite,
+	}
+}
@@ -0,0 +1,127 @@
+package auth
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/temu-in/temu.in/booking-system-backend/internal/models"
+)
+
+// Session is the public view of a refresh-token family, i.e. one device.
+type Session struct {
+	ID         string    `json:"id"`
+	UserAgent  string    `json:"user_agent"`
+	IP         string    `json:"ip"`
+	StartedAt  time.Time `json:"started_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	RememberMe bool      `json:"remember_me"`
+	Current    bool      `json:"current"`
+}
+
+// SessionList converts live refresh tokens into sessions, flagging the one
+// whose family matches currentSID.
+func SessionList(tokens []models.RefreshToken, currentSID string) []Session {
+	out := make([]Session, 0, len(tokens))
+	for _, t := range tokens {
+		out = append(out, Session{
+			ID:         t.FamilyID,
+			UserAgent:  t.UserAgent,
+			IP:         t.IP,
+			StartedAt:  t.StartedAt,
+			LastUsedAt: t.LastUsedAt,
+			ExpiresAt:  t.ExpiresAt,
+			RememberMe: t.RememberMe,
+			Current:    currentSID != "" && t.FamilyID == currentSID,
+		})
+	}
+	return out
+}
+
+// RegisterSessionRoutes mounts the self-service session API under /api/me;
+// rg must already require authentication.
+func (h *Handler) RegisterSessionRoutes(rg *gin.RouterGroup) {
+	rg.GET("/sessions", h.ListSessions)
+	rg.DELETE("/sessions/:id", h.RevokeSession)
+}
+
+func claimsFrom(c *gin.Context) (*Claims, bool) {
+	v, ok := c.Get(UserContextKey)
+	if !ok {
+		return nil, false
+	}
+	claims, ok := v.(*Claims)
+	return claims, ok
+}
+
+func (h *Handler) ListSessions(c *gin.Context) {
+	claims, ok := claimsFrom(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthenticated"})
+		return
+	}
+
+	tokens, err := h.tokens.ListActiveSessions(claims.UserID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"sessions": SessionList(tokens, claims.SessionID)})
+}
+
+// RevokeSession signs one of the caller's devices out, including any access
+// token it still holds.
+func (h *Handler) RevokeSession(c *gin.Context) {
+	claims, ok := claimsFrom(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthenticated"})
+		return
+	}
+
+	sid := c.Param("id")
+	found, err := h.tokens.RevokeSession(claims.UserID, sid)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed"})
+		return
+	}
+	if !found {
+		c.JSON(http.StatusNotFound, gin.H{"error": "session not found"})
+		return
+	}
+	if h.denylist != nil {
+		h.denylist.RevokeSession(c.Request.Context(), sid)
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "revoked"})
+}
+
+// LogoutAll revokes every session of the caller, this one included.
+func (h *Handler) LogoutAll(c *gin.Context) {
+	claims, ok := claimsFrom(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthenticated"})
+		return
+	}
+
+	if err := h.tokens.RevokeAllForUser(claims.UserID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed"})
+		return
+	}
+	if h.denylist != nil {
+		h.denylist.RevokeUser(c.Request.Context(), claims.UserID)
+	}
+	h.sessions.ClearCookie(c)
+	c.JSON(http.StatusOK, gin.H{"status": "logged_out"})
+}
+
+// currentRememberMe reports whether the caller's own session was started with
+// "remember me", so a session issued in its place keeps the same lifetime.
+func (h *Handler) currentRememberMe(c *gin.Context) bool {
+	cookie, err := c.Request.Cookie(RefreshCookieName)
+	if err != nil {
+		return false
+	}
+	rec, err := h.tokens.FindByHash(hashToken(cookie.Value))
+	return err == nil && rec != nil && rec.RememberMe
+}
@@ -0,0 +1,140 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+
+	"github.com/temu-in/temu.in/booking-system-backend/internal/config"
+	"github.com/temu-in/temu.in/booking-system-backend/internal/mail"
+	"github.com/temu-in/temu.in/booking-system-backend/internal/models"
+	"github.com/temu-in/temu.in/booking-system-backend/internal/token"
+	"github.com/temu-in/temu.in/booking-system-backend/internal/user"
+)
+
+// NewVerificationLimiter allows one resent verification email per address per
+// cooldown and at most maxPerIP requests per window from one client IP.
+func NewVerificationLimiter(cache *redis.Client, cooldown time.Duration, maxPerIP int, window time.Duration) *RequestLimiter {
+	return NewRequestLimiter(cache, "verify:", cooldown, maxPerIP, window)
+}
+
+// WithVerificationLimiter rate-limits ResendVerification.
+func WithVerificationLimiter(l *RequestLimiter) Option {
+	return func(h *Handler) { h.resendLimiter = l }
+}
+
+func (h *Handler) sendVerification(ctx context.Context, u *models.User) error {
+	raw, err := h.issueActionToken(u.ID, token.PurposeEmailVerification, h.config.EmailVerificationTTL)
+	if err != nil {
+		return err
+	}
+
+	link := fmt.Sprintf("%s/verify-email?token=%s", h.config.AppURL, url.QueryEscape(raw))
+	return h.mailer.Send(ctx, mail.Message{
+		To:      u.Email,
+		Subject: "Confirm your temu.in email address",
+		Body: fmt.Sprintf("Welcome to temu.in!\n\nPlease confirm your email address by opening this link:\n%s\n\n"+
+			"The link expires in %s.", link, h.config.EmailVerificationTTL),
+	})
+}
+
+// VerifyEmail consumes the token from a verification link and marks the
+// owning account as verified.
+func (h *Handler) VerifyEmail(c *gin.Context) {
+	rec, err := h.tokens.ConsumeAction(hashToken(c.Param("token")), token.PurposeEmailVerification)
+	if err != nil {
+		if errors.Is(err, token.ErrActionTokenInvalid) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid or expired token"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal"})
+		return
+	}
+
+	if err := h.repo.MarkVerified(rec.UserID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "verify failed"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "verified"})
+}
+
+type resendVerificationReq struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+// ResendVerification issues a fresh verification link. Like ForgotPassword it
+// answers identically whether or not the address is registered, sending the
+// email after the response.
+func (h *Handler) ResendVerification(c *gin.Context) {
+	var req resendVerificationReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if h.resendLimiter != nil {
+		if wait := h.resendLimiter.Allow(c.Request.Context(), req.Email, c.ClientIP()); wait > 0 {
+			tooManyAttempts(c, wait)
+			return
+		}
+	}
+
+	u, err := h.repo.FindByEmail(req.Email)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal"})
+		return
+	}
+	if u != nil && !u.IsVerified {
+		h.background(func(ctx context.Context) {
+			if err := h.sendVerification(ctx, u); err != nil {
+				log.Printf("email verification for user %d: %v", u.ID, err)
+			}
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "verification_sent"})
+}
+
+// RequireVerified rejects users whose email is not verified when the policy
+// restricts booking (or login). Mount it after Middleware on booking routes.
+// Tokens record whether the email was verified when they were issued; only
+// tokens that say it was not are checked against the database, so a user who
+// has just verified is let through without refreshing first.
+func RequireVerified(repo *user.Repository, policy string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if policy == config.UnverifiedAllow {
+			c.Next()
+			return
+		}
+		v, ok := c.Get(UserContextKey)
+		if !ok {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "missing claims"})
+			return
+		}
+		claims, ok := v.(*Claims)
+		if !ok {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "invalid claims"})
+			return
+		}
+		if claims.Verified {
+			c.Next()
+			return
+		}
+		u, err := repo.FindByID(claims.UserID)
+		if err != nil || u == nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid token"})
+			return
+		}
+		if !u.IsVerified {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "email not verified"})
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,69 @@
+package auth
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/temu-in/temu.in/booking-system-backend/internal/config"
+)
+
+func TestRequireVerified(t *testing.T) {
+	e := newTestEnv(t, nil)
+	u := e.createUser(t, "ana@example.com", "old-password-1")
+	if err := e.db.Model(u).Update("is_verified", false).Error; err != nil {
+		t.Fatal(err)
+	}
+	e.router.GET("/book", Middleware(e.keys), RequireVerified(e.users, config.UnverifiedBlockBooking), func(c *gin.Context) {
+		c.Status(http.StatusNoContent)
+	})
+	book := func(verified bool) int {
+		tok, err := NewToken(e.keys, &Claims{UserID: u.ID, Role: u.Role, Verified: verified}, e.cfg.AccessTokenTTL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return e.do(t, http.MethodGet, "/book", nil, "Authorization", "Bearer "+tok).Code
+	}
+
+	if got := book(false); got != http.StatusForbidden {
+		t.Errorf("unverified: status %d, want 403", got)
+	}
+	// a token saying the email is verified is trusted as is
+	if got := book(true); got != http.StatusNoContent {
+		t.Errorf("verified token: status %d, want 204", got)
+	}
+	// an older token is let through once the email has been verified
+	if err := e.users.MarkVerified(u.ID); err != nil {
+		t.Fatal(err)
+	}
+	if got := book(false); got != http.StatusNoContent {
+		t.Errorf("verified since issue: status %d, want 204", got)
+	}
+}
+
+func TestResendVerificationRateLimit(t *testing.T) {
+	e := newTestEnv(t, nil, WithVerificationLimiter(NewVerificationLimiter(nil, time.Minute, 3, time.Hour)))
+	u := e.createUser(t, "ana@example.com", "old-password-1")
+	if err := e.db.Model(u).Update("is_verified", false).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	w := e.do(t, http.MethodPost, "/auth/resend-verification", resendVerificationReq{Email: "ana@example.com"})
+	wantStatus(t, w, http.StatusOK)
+	w = e.do(t, http.MethodPost, "/auth/resend-verification", resendVerificationReq{Email: "ana@example.com"})
+	wantStatus(t, w, http.StatusTooManyRequests)
+	e.h.pending.Wait()
+	if n := len(e.outbox.Messages()); n != 1 {
+		t.Errorf("sent %d emails, want 1", n)
+	}
+
+	// the client IP is limited across addresses
+	for _, email := range []string{"b@example.com", "c@example.com"} {
+		w = e.do(t, http.MethodPost, "/auth/resend-verification", resendVerificationReq{Email: email})
+		wantStatus(t, w, http.StatusOK)
+	}
+	w = e.do(t, http.MethodPost, "/auth/resend-verification", resendVerificationReq{Email: "d@example.com"})
+	wantStatus(t, w, http.StatusTooManyRequests)
+}
@@ -0,0 +1,157 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/temu-in/temu.in/booking-system-backend/internal/token"
+	"github.com/temu-in/temu.in/booking-system-backend/internal/user"
+)
+
+// ChannelSecurityVersion announces security version bumps as
+// "<user id>:<version>".
+const ChannelSecurityVersion = "security_version"
+
+// How long a cached version is trusted. While a Subscriber delivers bumps from
+// other instances entries stay fresh on their own and only need evicting
+// eventually; without one the window bounds how long another instance's bump
+// can go unnoticed.
+const (
+	versionTTLSubscribed = 10 * time.Minute
+	versionTTLPolling    = 5 * time.Second
+
+	// past this many entries stale ones are pruned on insert
+	versionCacheMaxEntries = 10000
+)
+
+// VersionCache answers "what is this user's security version" for Middleware
+// without a database query per request.
+type VersionCache struct {
+	load  func(userID uint) (uint, error)
+	cache *redis.Client     // optional; used to announce bumps
+	sub   *token.Subscriber // optional; see Attach
+
+	mu      sync.Mutex
+	entries map[uint]versionEntry
+}
+
+type versionEntry struct {
+	version uint
+	fetched time.Time
+}
+
+// NewVersionCache creates a cache backed by load, normally
+// user.Repository.SecurityVersion. cache may be nil on a single instance.
+func NewVersionCache(load func(userID uint) (uint, error), cache *redis.Client) *VersionCache {
+	return &VersionCache{load: load, cache: cache, entries: map[uint]versionEntry{}}
+}
+
+// Current returns the user's security version.
+func (v *VersionCache) Current(userID uint) (uint, error) {
+	ttl := versionTTLPolling
+	if v.sub.Healthy() {
+		ttl = versionTTLSubscribed
+	}
+	v.mu.Lock()
+	e, ok := v.entries[userID]
+	v.mu.Unlock()
+	if ok && time.Since(e.fetched) < ttl {
+		return e.version, nil
+	}
+
+	version, err := v.load(userID)
+	if err != nil {
+		return 0, err
+	}
+	v.set(userID, version)
+	return version, nil
+}
+
+// Stale reports whether claims were issued before the latest security change
+// of their user or, for impersonation tokens, of the acting staff member.
+func (v *VersionCache) Stale(claims *Claims) (bool, error) {
+	current, err := v.Current(claims.UserID)
+	if err != nil {
+		return false, err
+	}
+	if claims.Version < current {
+		return true, nil
+	}
+	if claims.Act != nil {
+		actor, err := v.Current(claims.Act.UserID)
+		if err != nil {
+			return false, err
+		}
+		return claims.Act.Version < actor, nil
+	}
+	return false, nil
+}
+
+// Changed records a bump made by this instance and announces it to the
+// others. Register it with user.Repository.OnSecurityVersionChange.
+func (v *VersionCache) Changed(userID, version uint) {
+	v.set(userID, version)
+	if v.cache == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := v.cache.Publish(ctx, ChannelSecurityVersion, fmt.Sprintf("%d:%d", userID, version)).Err(); err != nil {
+		log.Printf("security version: publish user %d: %v", userID, err)
+	}
+}
+
+// Attach keeps the cache in sync with bumps made by other instances.
+func (v *VersionCache) Attach(sub *token.Subscriber) {
+	v.sub = sub
+	sub.Handle(ChannelSecurityVersion, v.apply)
+	sub.OnConnect(v.reset)
+}
+
+func (v *VersionCache) apply(payload string) {
+	id, ver, ok := strings.Cut(payload, ":")
+	if !ok {
+		return
+	}
+	userID, err1 := strconv.ParseUint(id, 10, 64)
+	version, err2 := strconv.ParseUint(ver, 10, 64)
+	if err1 != nil || err2 != nil {
+		return
+	}
+	v.set(uint(userID), uint(version))
+}
+
+// reset drops everything cached, since bumps may have been missed while the
+// subscriber was disconnected.
+func (v *VersionCache) reset(context.Context) error {
+	v.mu.Lock()
+	v.entries = map[uint]versionEntry{}
+	v.mu.Unlock()
+	return nil
+}
+
+// set stores version unless a newer one is already known. A disabled account
+// coming back is the exception: its real version is below the placeholder.
+func (v *VersionCache) set(userID, version uint) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if e, ok := v.entries[userID]; ok && e.version > version && e.version != user.DisabledVersion {
+		return
+	}
+	now := time.Now()
+	v.entries[userID] = versionEntry{version: version, fetched: now}
+	if len(v.entries) > versionCacheMaxEntries {
+		for id, e := range v.entries {
+			if now.Sub(e.fetched) >= versionTTLSubscribed {
+				delete(v.entries, id)
+			}
+		}
+	}
+}
@@ -2,22 +2,130 @@ package config
 
 import (
 	"fmt"
+	"log"
+	"net"
+	"strings"
 	"time"
 
 	"github.com/caarlos0/env/v11"
 )
 
+// Values accepted by UNVERIFIED_POLICY.
+const (
+	UnverifiedAllow        = "allow"
+	UnverifiedBlockBooking = "booking"
+	UnverifiedBlockLogin   = "login"
+)
+
 type Config struct {
-	AppEnv            string        `env:"APP_ENV,notEmpty"`
-	Port              int           `env:"PORT" envDefault:"8080"`
-	DatabaseURL       string        `env:"DATABASE_URL,notEmpty"`
-	RedisURL          string        `env:"REDIS_URL,notEmpty"`
-	JWTSecret         string        `env:"JWT_SECRET,notEmpty"`
-	AccessTokenTTL    time.Duration `env:"ACCESS_TOKEN_TTL" envDefault:"15m"`
-	RefreshTokenTTL   time.Duration `env:"REFRESH_TOKEN_TTL" envDefault:"168h"`
-	SendGridAPIKey    string        `env:"SENDGRID_API_KEY"`
-	MidtransServerKey string        `env:"MIDTRANS_SERVER_KEY"`
-	MidtransClientKey string        `env:"MIDTRANS_CLIENT_KEY"`
+	AppEnv      string `env:"APP_ENV,notEmpty"`
+	Port        int    `env:"PORT" envDefault:"8080"`
+	DatabaseURL string `env:"DATABASE_URL,notEmpty"`
+	RedisURL    string `env:"REDIS_URL,notEmpty"`
+	JWTSecret   string `env:"JWT_SECRET,notEmpty"`
+	// JWTKeysFile points to a JSON keyring (see auth.LoadKeyring). When empty
+	// tokens are signed HS256 with JWTSecret.
+	JWTKeysFile         string        `env:"JWT_KEYS_FILE"`
+	JWTKeyGrace         time.Duration `env:"JWT_KEY_GRACE" envDefault:"24h"`
+	JWTIssuer           string        `env:"JWT_ISSUER" envDefault:"temu.in"`
+	JWTAudience         string        `env:"JWT_AUDIENCE" envDefault:"temu.in-api"`
+	AccessTokenTTL      time.Duration `env:"ACCESS_TOKEN_TTL" envDefault:"15m"`
+	RefreshTokenTTL     time.Duration `env:"REFRESH_TOKEN_TTL" envDefault:"168h"`
+	LoginMaxPerEmail    int           `env:"LOGIN_MAX_ATTEMPTS_PER_EMAIL" envDefault:"5"`
+	LoginMaxPerIP       int           `env:"LOGIN_MAX_ATTEMPTS_PER_IP" envDefault:"20"`
+	LoginFailWindow     time.Duration `env:"LOGIN_FAILURE_WINDOW" envDefault:"15m"`
+	LoginLockoutBase    time.Duration `env:"LOGIN_LOCKOUT_BASE" envDefault:"1m"`
+	LoginLockoutMax     time.Duration `env:"LOGIN_LOCKOUT_MAX" envDefault:"1h"`
+	MFARequiredForAdmin bool          `env:"MFA_REQUIRED_FOR_ADMIN" envDefault:"false"`
+	MFAChallengeTTL     time.Duration `env:"MFA_CHALLENGE_TTL" envDefault:"5m"`
+	TOTPIssuer          string        `env:"TOTP_ISSUER" envDefault:"temu.in"`
+	SendGridAPIKey      string        `env:"SENDGRID_API_KEY"`
+	MailFrom            string        `env:"MAIL_FROM" envDefault:"no-reply@temu.in"`
+	AppURL              string        `env:"APP_URL" envDefault:"http://localhost:5173"`
+	PasswordResetTTL    time.Duration `env:"PASSWORD_RESET_TTL" envDefault:"30m"`
+	// Argon2id cost for password hashes (memory in KiB). Stored hashes made
+	// with weaker settings are upgraded on the next login.
+	PasswordArgon2Memory      uint32 `env:"PASSWORD_ARGON2_MEMORY" envDefault:"65536"`
+	PasswordArgon2Iterations  uint32 `env:"PASSWORD_ARGON2_ITERATIONS" envDefault:"3"`
+	PasswordArgon2Parallelism uint8  `env:"PASSWORD_ARGON2_PARALLELISM" envDefault:"2"`
+	// Password policy for new passwords. PasswordBreachedFile lists breached
+	// passwords, one plain password or SHA-1 hex digest per line, checked on
+	// top of the bundled common-password list.
+	PasswordMinLength    int      `env:"PASSWORD_MIN_LENGTH" envDefault:"8"`
+	PasswordBlockedWords []string `env:"PASSWORD_BLOCKED_WORDS" envSeparator:","`
+	PasswordBreachedFile string   `env:"PASSWORD_BREACHED_FILE"`
+	// API keys expire APIKeyDefaultTTL after creation unless the owner picks a
+	// date, which may be at most APIKeyMaxTTL away.
+	APIKeyDefaultTTL time.Duration `env:"API_KEY_DEFAULT_TTL" envDefault:"2160h"`
+	APIKeyMaxTTL     time.Duration `env:"API_KEY_MAX_TTL" envDefault:"8760h"`
+	// AuthzPolicyFile maps roles to permissions (see auth.LoadRolePolicy);
+	// when empty the built-in mapping is used.
+	AuthzPolicyFile string `env:"AUTHZ_POLICY_FILE"`
+	// ImpersonationTTL is the lifetime of "login as user" tokens issued to staff.
+	ImpersonationTTL time.Duration `env:"IMPERSONATION_TTL" envDefault:"15m"`
+	// CSRFTrustedOrigins are the browser origins (scheme://host[:port]) allowed
+	// to call cookie-authenticated endpoints and, via CORS, the API at all.
+	// Empty means the origin of AppURL.
+	CSRFTrustedOrigins []string `env:"CSRF_TRUSTED_ORIGINS" envSeparator:","`
+	// TrustedProxies are the addresses or CIDRs of reverse proxies whose
+	// X-Forwarded-For is believed when taking the client IP for rate limits,
+	// sessions and security events. Empty trusts none, so the client IP is
+	// always the peer address.
+	TrustedProxies []string `env:"TRUSTED_PROXIES" envSeparator:","`
+	// Forgot-password requests: an address gets at most one reset email per
+	// PasswordResetCooldown and a client IP at most PasswordResetMaxPerIP
+	// requests per PasswordResetWindow.
+	PasswordResetCooldown time.Duration `env:"PASSWORD_RESET_COOLDOWN" envDefault:"1m"`
+	PasswordResetMaxPerIP int           `env:"PASSWORD_RESET_MAX_PER_IP" envDefault:"10"`
+	PasswordResetWindow   time.Duration `env:"PASSWORD_RESET_WINDOW" envDefault:"1h"`
+	// Magic-link login: a link is valid for MagicLinkTTL, an address gets at
+	// most one per MagicLinkCooldown and a client IP at most MagicLinkMaxPerIP
+	// per MagicLinkWindow.
+	MagicLinkTTL      time.Duration `env:"MAGIC_LINK_TTL" envDefault:"15m"`
+	MagicLinkCooldown time.Duration `env:"MAGIC_LINK_COOLDOWN" envDefault:"1m"`
+	MagicLinkMaxPerIP int           `env:"MAGIC_LINK_MAX_PER_IP" envDefault:"10"`
+	MagicLinkWindow   time.Duration `env:"MAGIC_LINK_WINDOW" envDefault:"1h"`
+	// OpenID Connect login. Google is enabled by its client credentials; one
+	// more provider can be configured by issuer. Callbacks go to
+	// OIDCCallbackURL + "/<provider>/callback", which must be registered with
+	// each provider.
+	OIDCCallbackURL    string   `env:"OIDC_CALLBACK_URL" envDefault:"http://localhost:8080/api/auth/oidc"`
+	GoogleClientID     string   `env:"GOOGLE_CLIENT_ID"`
+	GoogleClientSecret string   `env:"GOOGLE_CLIENT_SECRET"`
+	OIDCProviderName   string   `env:"OIDC_PROVIDER_NAME" envDefault:"oidc"`
+	OIDCIssuer         string   `env:"OIDC_ISSUER"`
+	OIDCClientID       string   `env:"OIDC_CLIENT_ID"`
+	OIDCClientSecret   string   `env:"OIDC_CLIENT_SECRET"`
+	OIDCScopes         []string `env:"OIDC_SCOPES" envDefault:"openid,email,profile" envSeparator:","`
+	// WebAuthn relying party for passkeys. WebAuthnRPID defaults to the host of
+	// AppURL and WebAuthnOrigins to AppURL itself.
+	WebAuthnRPID    string        `env:"WEBAUTHN_RP_ID"`
+	WebAuthnRPName  string        `env:"WEBAUTHN_RP_NAME" envDefault:"temu.in"`
+	WebAuthnOrigins []string      `env:"WEBAUTHN_ORIGINS" envSeparator:","`
+	WebAuthnTimeout time.Duration `env:"WEBAUTHN_TIMEOUT" envDefault:"5m"`
+	// Session lifetimes: RefreshTokenTTL above bounds a "remember me" session,
+	// SessionLifetime any other one; refreshing extends neither. A session
+	// also ends after SessionIdleTimeout without a refresh (0 disables it).
+	SessionLifetime    time.Duration `env:"SESSION_LIFETIME" envDefault:"24h"`
+	SessionIdleTimeout time.Duration `env:"SESSION_IDLE_TIMEOUT" envDefault:"2h"`
+	// SessionCookieSameSite overrides the refresh cookie's SameSite attribute
+	// ("strict", "lax" or "none"); empty picks strict in production and lax
+	// elsewhere.
+	SessionCookieSameSite string `env:"SESSION_COOKIE_SAMESITE"`
+	SessionCookieDomain   string `env:"SESSION_COOKIE_DOMAIN"`
+	// UnverifiedPolicy controls what users with an unverified email may do:
+	// "allow" (no restriction), "booking" (blocked from booking routes) or
+	// "login" (cannot log in at all).
+	UnverifiedPolicy     string        `env:"UNVERIFIED_POLICY" envDefault:"allow"`
+	EmailVerificationTTL time.Duration `env:"EMAIL_VERIFICATION_TTL" envDefault:"48h"`
+	// Resending verification links: an address gets at most one per
+	// VerificationResendCooldown and a client IP at most
+	// VerificationResendMaxPerIP requests per VerificationResendWindow.
+	VerificationResendCooldown time.Duration `env:"VERIFICATION_RESEND_COOLDOWN" envDefault:"1m"`
+	VerificationResendMaxPerIP int           `env:"VERIFICATION_RESEND_MAX_PER_IP" envDefault:"10"`
+	VerificationResendWindow   time.Duration `env:"VERIFICATION_RESEND_WINDOW" envDefault:"1h"`
+	MidtransServerKey          string        `env:"MIDTRANS_SERVER_KEY"`
+	MidtransClientKey          string        `env:"MIDTRANS_CLIENT_KEY"`
 }
 
 func Load() (*Config, error) {
@@ -26,5 +134,51 @@ func Load() (*Config, error) {
 		return nil, fmt.Errorf("parse env: %w", err)
 	}
 
+	switch cfg.UnverifiedPolicy {
+	case UnverifiedAllow, UnverifiedBlockBooking, UnverifiedBlockLogin:
+	default:
+		return nil, fmt.Errorf("invalid UNVERIFIED_POLICY %q", cfg.UnverifiedPolicy)
+	}
+
+	for _, p := range cfg.TrustedProxies {
+		if net.ParseIP(p) == nil {
+			if _, _, err := net.ParseCIDR(p); err != nil {
+				return nil, fmt.Errorf("invalid TRUSTED_PROXIES entry %q", p)
+			}
+		}
+	}
+
+	switch strings.ToLower(cfg.SessionCookieSameSite) {
+	case "", "strict", "lax", "none":
+	default:
+		return nil, fmt.Errorf("invalid SESSION_COOKIE_SAMESITE %q", cfg.SessionCookieSameSite)
+	}
+	if cfg.PasswordArgon2Iterations == 0 || cfg.PasswordArgon2Parallelism == 0 || cfg.PasswordArgon2Memory < 8*uint32(cfg.PasswordArgon2Parallelism) {
+		return nil, fmt.Errorf("invalid PASSWORD_ARGON2_* settings")
+	}
+	if cfg.PasswordMinLength < 1 {
+		return nil, fmt.Errorf("PASSWORD_MIN_LENGTH must be at least 1")
+	}
+	if cfg.OIDCIssuer != "" && (cfg.OIDCClientID == "" || cfg.OIDCProviderName == "" || cfg.OIDCProviderName == "google") {
+		return nil, fmt.Errorf("OIDC_ISSUER needs OIDC_CLIENT_ID and a provider name other than google")
+	}
+	if cfg.MagicLinkTTL <= 0 {
+		return nil, fmt.Errorf("MAGIC_LINK_TTL must be positive")
+	}
+	if cfg.SessionLifetime <= 0 || cfg.RefreshTokenTTL <= 0 {
+		return nil, fmt.Errorf("SESSION_LIFETIME and REFRESH_TOKEN_TTL must be positive")
+	}
+	if cfg.SessionIdleTimeout < 0 {
+		return nil, fmt.Errorf("SESSION_IDLE_TIMEOUT must not be negative")
+	}
+	if cfg.SessionIdleTimeout > 0 {
+		switch {
+		case cfg.SessionIdleTimeout >= cfg.SessionLifetime && cfg.SessionIdleTimeout >= cfg.RefreshTokenTTL:
+			return nil, fmt.Errorf("SESSION_IDLE_TIMEOUT %s would never apply: it must be shorter than SESSION_LIFETIME or REFRESH_TOKEN_TTL (0 disables it)", cfg.SessionIdleTimeout)
+		case cfg.SessionIdleTimeout >= cfg.SessionLifetime:
+			log.Printf("config: SESSION_IDLE_TIMEOUT %s is not shorter than SESSION_LIFETIME %s, so it only applies to remember-me sessions", cfg.SessionIdleTimeout, cfg.SessionLifetime)
+		}
+	}
+
 	return cfg, nil
 }
@@ -0,0 +1,67 @@
+package mail
+
+import (
+	"context"
+	"log"
+	"sync"
+)
+
+// Message is a plain-text email ready to be delivered.
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Sender delivers transactional email. Handlers depend on this interface so
+// tests and local development can swap in an in-memory outbox.
+type Sender interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// Outbox is an in-memory Sender that keeps every message it is given.
+type Outbox struct {
+	mu       sync.Mutex
+	messages []Message
+}
+
+func NewOutbox() *Outbox {
+	return &Outbox{}
+}
+
+func (o *Outbox) Send(_ context.Context, msg Message) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.messages = append(o.messages, msg)
+	return nil
+}
+
+// Messages returns a copy of everything sent so far.
+func (o *Outbox) Messages() []Message {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	out := make([]Message, len(o.messages))
+	copy(out, o.messages)
+	return out
+}
+
+// Last returns the most recent message sent to the given address.
+func (o *Outbox) Last(to string) (Message, bool) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	for i := len(o.messages) - 1; i >= 0; i-- {
+		if o.messages[i].To == to {
+			return o.messages[i], true
+		}
+	}
+	return Message{}, false
+}
+
+// LogSender writes messages to the process log instead of delivering them.
+// It is used when no mail provider is configured.
+type LogSender struct{}
+
+func (LogSender) Send(_ context.Context, msg Message) error {
+	log.Printf("mail: to=%s subject=%q\n%s", msg.To, msg.Subject, msg.Body)
+	return nil
+}
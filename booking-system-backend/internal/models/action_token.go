@@ -0,0 +1,29 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ActionToken is a single-use, expiring token that authorises one action
+// (e.g. a password reset). Only the SHA-256 hash of the token is stored.
+type ActionToken struct {
+	ID        uint           `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
+
+	TokenHash string     `gorm:"uniqueIndex;not null" json:"-"`
+	UserID    uint       `gorm:"index;not null" json:"user_id"`
+	Purpose   string     `gorm:"index;not null" json:"purpose"` // e.g. password_reset
+	ExpiresAt time.Time  `json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at"`
+	// BindingHash, when set, is the hash of a nonce the consuming browser must
+	// present, so a token only works where it was requested.
+	BindingHash string `json:"-"`
+	// AMR holds the space-separated authentication methods already passed
+	// when the token is an MFA challenge, so the session it leads to records
+	// the real first factor.
+	AMR string `json:"-"`
+}
@@ -1,17 +1,41 @@
 package models
 
 import (
-    "time"
+	"errors"
+	"time"
 
-    "gorm.io/gorm"
+	"gorm.io/gorm"
 )
 
+// ErrAuditImmutable is returned for any attempt to change or delete an
+// AdminAudit entry through GORM.
+var ErrAuditImmutable = errors.New("admin audit entries cannot be changed or deleted")
+
+// AdminAudit is an append-only log of staff actions. Entries form a hash
+// chain: Hash covers the entry's content and PrevHash, the Hash of the entry
+// before it, so editing or removing a row breaks every link after it.
 type AdminAudit struct {
-    ID        uint           `gorm:"primaryKey" json:"id"`
-    CreatedAt time.Time      `json:"created_at"`
-    ActorID   uint           `json:"actor_id"`
-    Action    string         `json:"action"`
-    Target    string         `json:"target"` // e.g., user:email
-    Details   string         `json:"details"`
-    DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
+	ID        uint      `gorm:"primaryKey;index:idx_admin_audits_created_id,priority:2" json:"id"`
+	CreatedAt time.Time `gorm:"index:idx_admin_audits_created_id,priority:1" json:"created_at"`
+	ActorID   uint      `gorm:"index" json:"actor_id"`
+	Action    string    `gorm:"index" json:"action"`
+	Target    string    `json:"target"` // e.g., user:email
+	Details   string    `json:"details"`
+	PrevHash  string    `gorm:"not null;default:''" json:"prev_hash"`
+	Hash      string    `gorm:"not null;default:''" json:"hash"`
+}
+
+func (a *AdminAudit) BeforeUpdate(*gorm.DB) error { return ErrAuditImmutable }
+
+func (a *AdminAudit) BeforeDelete(*gorm.DB) error { return ErrAuditImmutable }
+
+// AuditChainHead records the last AdminAudit hash and how many entries lead
+// up to it. It is kept apart from the log so that removing entries from the
+// end, which leaves the remaining chain intact, still shows up on
+// verification. There is a single row.
+type AuditChainHead struct {
+	ID        uint      `gorm:"primaryKey" json:"-"`
+	Hash      string    `gorm:"not null" json:"hash"`
+	Entries   int64     `gorm:"not null" json:"entries"`
+	UpdatedAt time.Time `json:"updated_at"`
 }
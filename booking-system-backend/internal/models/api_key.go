@@ -0,0 +1,30 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// APIKey is a personal access token for scripts and other machine clients.
+// Only the SHA-256 hash of the key is stored; Prefix is kept in clear so users
+// can tell their keys apart.
+type APIKey struct {
+	ID        uint           `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
+
+	UserID  uint   `gorm:"index;not null" json:"user_id"`
+	Name    string `gorm:"not null" json:"name"`
+	Prefix  string `gorm:"index;not null" json:"prefix"`
+	KeyHash string `gorm:"uniqueIndex;not null" json:"-"`
+	// Scopes is space-separated, e.g. "bookings:read admin:users".
+	Scopes string `json:"scopes"`
+	// AMR is copied from the session that created the key, so a key minted
+	// after 2FA satisfies RequireMFA like that session did.
+	AMR        string     `json:"-"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+}
@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// Identity links a user to an account at an external OpenID Connect
+// provider. Subject is the provider's stable user id ("sub" claim); Email is
+// what the provider reported at the last login and only informational.
+type Identity struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	UserID      uint       `gorm:"index;not null" json:"user_id"`
+	Provider    string     `gorm:"uniqueIndex:idx_identity_provider_subject;not null" json:"provider"`
+	Subject     string     `gorm:"uniqueIndex:idx_identity_provider_subject;not null" json:"-"`
+	Email       string     `json:"email"`
+	LastLoginAt *time.Time `json:"last_login_at"`
+}
@@ -0,0 +1,29 @@
+package models
+
+import "time"
+
+// Passkey is a WebAuthn credential registered by a user. Only the public key
+// is stored; the private key never leaves the authenticator. Deleting a passkey
+// removes the row so the authenticator can be registered again.
+type Passkey struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	UserID          uint   `gorm:"index;not null" json:"user_id"`
+	Name            string `gorm:"not null" json:"name"`
+	CredentialID    []byte `gorm:"uniqueIndex;not null" json:"-"`
+	PublicKey       []byte `gorm:"not null" json:"-"`
+	AttestationType string `json:"-"`
+	AAGUID          []byte `json:"-"`
+	// SignCount is the authenticator's signature counter from the last login.
+	// A counter that fails to increase hints at a cloned authenticator, which
+	// sets CloneWarning.
+	SignCount    uint32 `json:"sign_count"`
+	CloneWarning bool   `json:"clone_warning"`
+	// Transports is space-separated, e.g. "internal hybrid".
+	Transports     string     `json:"transports"`
+	BackupEligible bool       `json:"backup_eligible"`
+	BackupState    bool       `json:"backup_state"`
+	LastUsedAt     *time.Time `json:"last_used_at"`
+}
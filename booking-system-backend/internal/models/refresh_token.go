@@ -1,19 +1,40 @@
 package models
 
 import (
-    "time"
+	"time"
 
-    "gorm.io/gorm"
+	"gorm.io/gorm"
 )
 
 type RefreshToken struct {
-    ID        uint           `gorm:"primaryKey" json:"id"`
-    CreatedAt time.Time      `json:"created_at"`
-    UpdatedAt time.Time      `json:"updated_at"`
-    DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
+	ID        uint           `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
 
-    TokenHash string    `gorm:"index;not null" json:"-"`
-    UserID    uint      `gorm:"index;not null" json:"user_id"`
-    ExpiresAt time.Time `json:"expires_at"`
-    Revoked   bool      `gorm:"default:false" json:"revoked"`
+	TokenHash string    `gorm:"index;not null" json:"-"`
+	UserID    uint      `gorm:"index;not null" json:"user_id"`
+	ExpiresAt time.Time `json:"expires_at"`
+	Revoked   bool      `gorm:"default:false" json:"revoked"`
+	// FamilyID is shared by every token produced by rotating the same login,
+	// so a replayed token can revoke the whole lineage.
+	FamilyID string `gorm:"index" json:"-"`
+	// Rotated marks tokens revoked by rotation rather than logout; only those
+	// indicate theft when presented again.
+	Rotated bool `gorm:"default:false" json:"-"`
+	// RotatedAt is when the token was rotated; a replay shortly after is a
+	// concurrent refresh from another tab rather than theft.
+	RotatedAt *time.Time `json:"-"`
+	// AMR holds the space-separated authentication methods of the login, so
+	// rotated access tokens keep e.g. their "otp" marker.
+	AMR string `json:"-"`
+	// RememberMe selects the longer absolute lifetime and a persistent cookie.
+	RememberMe bool `gorm:"default:false" json:"remember_me"`
+
+	// Device details for the session list. StartedAt is the login time and is
+	// carried over on rotation; LastUsedAt is the last refresh.
+	UserAgent  string    `json:"user_agent"`
+	IP         string    `json:"ip"`
+	StartedAt  time.Time `json:"started_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
 }
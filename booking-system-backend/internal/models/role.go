@@ -0,0 +1,89 @@
+package models
+
+import (
+	"database/sql/driver"
+	"fmt"
+)
+
+// Role is a user's role. It only ever holds one of the values below; Value
+// refuses to store anything else.
+type Role string
+
+const (
+	RoleCustomer Role = "customer"
+	RoleProvider Role = "provider"
+	// staff roles
+	RoleSupport Role = "support"
+	RoleFinance Role = "finance"
+	RoleAdmin   Role = "admin"
+)
+
+// Roles lists every valid role.
+var Roles = []Role{RoleCustomer, RoleProvider, RoleSupport, RoleFinance, RoleAdmin}
+
+// legacyRoleUser is what accounts created before roles were typed hold; it
+// reads as RoleCustomer.
+const legacyRoleUser = "user"
+
+// ParseRole validates s as a role name.
+func ParseRole(s string) (Role, error) {
+	if s == legacyRoleUser {
+		return RoleCustomer, nil
+	}
+	r := Role(s)
+	if !r.Valid() {
+		return "", fmt.Errorf("unknown role %q", s)
+	}
+	return r, nil
+}
+
+func (r Role) Valid() bool {
+	for _, v := range Roles {
+		if r == v {
+			return true
+		}
+	}
+	return false
+}
+
+// IsStaff reports whether the role belongs to the operator side (support,
+// finance, admin) rather than to customers and providers.
+func (r Role) IsStaff() bool {
+	return r == RoleSupport || r == RoleFinance || r == RoleAdmin
+}
+
+func (r Role) Value() (driver.Value, error) {
+	if !r.Valid() {
+		return nil, fmt.Errorf("unknown role %q", string(r))
+	}
+	return string(r), nil
+}
+
+func (r *Role) Scan(src interface{}) error {
+	var s string
+	switch v := src.(type) {
+	case string:
+		s = v
+	case []byte:
+		s = string(v)
+	default:
+		return fmt.Errorf("scan role: unsupported type %T", src)
+	}
+	parsed, err := ParseRole(s)
+	if err != nil {
+		return err
+	}
+	*r = parsed
+	return nil
+}
+
+// UnmarshalText validates roles decoded from JSON, e.g. token claims and
+// request bodies.
+func (r *Role) UnmarshalText(b []byte) error {
+	parsed, err := ParseRole(string(b))
+	if err != nil {
+		return err
+	}
+	*r = parsed
+	return nil
+}
@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+// SecurityEvent records an authentication incident such as refresh-token
+// reuse. Unlike AdminAudit the actor is usually unknown, so the affected user
+// and client details are stored instead.
+type SecurityEvent struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time `gorm:"index" json:"created_at"`
+	UserID    uint      `gorm:"index" json:"user_id"`
+	Event     string    `gorm:"index;not null" json:"event"` // e.g. refresh_token_reuse
+	IP        string    `json:"ip"`
+	UserAgent string    `json:"user_agent"`
+	Details   string    `json:"details"`
+}
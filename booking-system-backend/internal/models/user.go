@@ -1,19 +1,48 @@
 package models
 
 import (
-    "time"
+	"time"
 
-    "gorm.io/gorm"
+	"gorm.io/gorm"
 )
 
 type User struct {
-    ID        uint           `gorm:"primaryKey" json:"id"`
-    CreatedAt time.Time      `json:"created_at"`
-    UpdatedAt time.Time      `json:"updated_at"`
-    DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
-
-    Email    string `gorm:"uniqueIndex;not null" json:"email"`
-    Password string `gorm:"not null" json:"-"`
-    Name     string `json:"name"`
-    Role     string `gorm:"default:user" json:"role"` // roles: user, admin
+	ID        uint           `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time      `gorm:"index" json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
+
+	Email    string `gorm:"uniqueIndex;not null" json:"email"`
+	Password string `gorm:"not null" json:"-"`
+	Name     string `json:"name"`
+	Role     Role   `gorm:"type:varchar(20);default:customer;not null;index" json:"role"`
+
+	IsVerified bool       `gorm:"default:false;not null" json:"is_verified"`
+	VerifiedAt *time.Time `json:"verified_at"`
+
+	// TOTP two-factor authentication. TOTPSecret is set during enrollment and
+	// only takes effect once TOTPEnabled is true; TOTPLastStep blocks replaying
+	// a code inside its validity window.
+	TOTPSecret   string `json:"-"`
+	TOTPEnabled  bool   `gorm:"default:false;not null" json:"totp_enabled"`
+	TOTPLastStep int64  `gorm:"default:0;not null" json:"-"`
+
+	// SecurityVersion is embedded in access tokens and bumped whenever the
+	// role, password or account status changes, which invalidates every token
+	// carrying an older value.
+	SecurityVersion uint `gorm:"default:1;not null" json:"-"`
+
+	// Suspension set by an admin. A suspension with SuspendedUntil in the past
+	// has lapsed; a nil SuspendedUntil lasts until lifted.
+	SuspendedAt    *time.Time `json:"suspended_at,omitempty"`
+	SuspendedUntil *time.Time `json:"suspended_until,omitempty"`
+	SuspendReason  string     `json:"suspend_reason,omitempty"`
+}
+
+// Suspended reports whether the account is suspended at now.
+func (u *User) Suspended(now time.Time) bool {
+	if u.SuspendedAt == nil {
+		return false
+	}
+	return u.SuspendedUntil == nil || now.Before(*u.SuspendedUntil)
 }
@@ -0,0 +1,209 @@
+// Package pagination implements listing for admin endpoints: parsing ?page,
+// ?per_page and ?sort (or ?cursor and ?limit), applying them to a query and
+// wrapping the results in a {data, pagination} envelope.
+package pagination
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	DefaultPerPage = 20
+	MaxPerPage     = 100
+)
+
+// Sorts maps the sort keys a list accepts to their columns. Only these keys
+// reach SQL.
+type Sorts map[string]string
+
+// Params is a page request. Sort is a key from the list's Sorts.
+type Params struct {
+	Page    int
+	PerPage int
+	Sort    string
+	Desc    bool
+
+	column string
+}
+
+// FromQuery reads ?page (from 1), ?per_page (up to MaxPerPage) and ?sort, a
+// key from sorts with a leading "-" for descending order. def is the sort used
+// when none is given, in the same form.
+func FromQuery(c *gin.Context, sorts Sorts, def string) (Params, error) {
+	p := Params{Page: 1, PerPage: DefaultPerPage}
+	if s := c.Query("page"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 {
+			return p, fmt.Errorf("page must be a positive integer")
+		}
+		p.Page = n
+	}
+	if s := c.Query("per_page"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 || n > MaxPerPage {
+			return p, fmt.Errorf("per_page must be between 1 and %d", MaxPerPage)
+		}
+		p.PerPage = n
+	}
+
+	sort := c.DefaultQuery("sort", def)
+	p.Desc = strings.HasPrefix(sort, "-")
+	p.Sort = strings.TrimPrefix(sort, "-")
+	col, ok := sorts[p.Sort]
+	if !ok {
+		return p, fmt.Errorf("cannot sort by %q", p.Sort)
+	}
+	p.column = col
+	return p, nil
+}
+
+// Offset is the number of rows before the requested page.
+func (p Params) Offset() int { return (p.Page - 1) * p.PerPage }
+
+// Apply orders and limits db to the requested page. Rows are ordered by id
+// after the sort column so pages do not shift between equal values.
+func (p Params) Apply(db *gorm.DB) *gorm.DB {
+	if p.column != "" {
+		db = db.Order(clause.OrderByColumn{Column: clause.Column{Name: p.column}, Desc: p.Desc})
+	}
+	return db.Order(clause.OrderByColumn{Column: clause.Column{Name: "id"}, Desc: p.Desc}).
+		Offset(p.Offset()).Limit(p.PerPage)
+}
+
+// Meta describes where a page sits in the full result.
+type Meta struct {
+	Page       int    `json:"page"`
+	PerPage    int    `json:"per_page"`
+	Total      int64  `json:"total"`
+	TotalPages int    `json:"total_pages"`
+	Sort       string `json:"sort"`
+}
+
+// Page is the response envelope for a list endpoint.
+type Page[T any] struct {
+	Data       []T  `json:"data"`
+	Pagination Meta `json:"pagination"`
+}
+
+// NewPage wraps one page of rows out of total matches.
+func NewPage[T any](rows []T, total int64, p Params) Page[T] {
+	if rows == nil {
+		rows = []T{}
+	}
+	sort := p.Sort
+	if p.Desc {
+		sort = "-" + sort
+	}
+	return Page[T]{
+		Data: rows,
+		Pagination: Meta{
+			Page:       p.Page,
+			PerPage:    p.PerPage,
+			Total:      total,
+			TotalPages: int((total + int64(p.PerPage) - 1) / int64(p.PerPage)),
+			Sort:       sort,
+		},
+	}
+}
+
+// EscapeLike escapes the LIKE wildcards in s so it matches literally.
+func EscapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+// Cursor marks a position in a list ordered by (created_at, id), for lists
+// that page with ?cursor instead of ?page. Unlike offsets it stays correct
+// while rows are being added.
+type Cursor struct {
+	CreatedAt time.Time
+	ID        uint
+}
+
+// Encode returns the opaque form handed to clients.
+func (c Cursor) Encode() string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatInt(c.CreatedAt.UnixNano(), 10) + "." + strconv.FormatUint(uint64(c.ID), 10)))
+}
+
+// DecodeCursor parses a cursor produced by Encode.
+func DecodeCursor(s string) (Cursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return Cursor{}, errInvalidCursor
+	}
+	ts, id, ok := strings.Cut(string(b), ".")
+	if !ok {
+		return Cursor{}, errInvalidCursor
+	}
+	nanos, err1 := strconv.ParseInt(ts, 10, 64)
+	n, err2 := strconv.ParseUint(id, 10, 64)
+	if err1 != nil || err2 != nil {
+		return Cursor{}, errInvalidCursor
+	}
+	return Cursor{CreatedAt: time.Unix(0, nanos), ID: uint(n)}, nil
+}
+
+var errInvalidCursor = errors.New("invalid cursor")
+
+// CursorParams is a cursor page request; After is nil for the first page.
+type CursorParams struct {
+	After *Cursor
+	Limit int
+}
+
+// CursorFromQuery reads ?cursor and ?limit (up to MaxPerPage).
+func CursorFromQuery(c *gin.Context) (CursorParams, error) {
+	p := CursorParams{Limit: DefaultPerPage}
+	if s := c.Query("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 || n > MaxPerPage {
+			return p, fmt.Errorf("limit must be between 1 and %d", MaxPerPage)
+		}
+		p.Limit = n
+	}
+	if s := c.Query("cursor"); s != "" {
+		cur, err := DecodeCursor(s)
+		if err != nil {
+			return p, err
+		}
+		p.After = &cur
+	}
+	return p, nil
+}
+
+// CursorMeta tells the client how to fetch the next page.
+type CursorMeta struct {
+	Limit      int    `json:"limit"`
+	NextCursor string `json:"next_cursor,omitempty"`
+	HasMore    bool   `json:"has_more"`
+}
+
+// CursorPage is the response envelope for a cursor-paged list.
+type CursorPage[T any] struct {
+	Data       []T        `json:"data"`
+	Pagination CursorMeta `json:"pagination"`
+}
+
+// NewCursorPage wraps rows fetched with a limit of p.Limit+1; the extra row,
+// if present, only signals that there is a next page and is dropped. cursor
+// returns the position of a row.
+func NewCursorPage[T any](rows []T, p CursorParams, cursor func(T) Cursor) CursorPage[T] {
+	page := CursorPage[T]{Data: rows, Pagination: CursorMeta{Limit: p.Limit}}
+	if len(rows) > p.Limit {
+		page.Data = rows[:p.Limit]
+		page.Pagination.HasMore = true
+		page.Pagination.NextCursor = cursor(page.Data[p.Limit-1]).Encode()
+	}
+	if page.Data == nil {
+		page.Data = []T{}
+	}
+	return page
+}
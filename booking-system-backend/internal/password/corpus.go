@@ -0,0 +1,132 @@
+package password
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	_ "embed"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// Corpus is a set of known-breached passwords, kept as the sorted first 8
+// bytes of each password's SHA-1. That is 8 bytes per entry whatever the
+// password length, and the chance of a false positive stays negligible even
+// for corpora with hundreds of millions of entries.
+type Corpus struct {
+	prefixes []uint64
+}
+
+// ReadCorpus parses one entry per line: either a 40-digit hex SHA-1 as in the
+// Have I Been Pwned downloads (an optional ":count" suffix is ignored) or a
+// plain password. Blank lines and lines starting with '#' are skipped.
+func ReadCorpus(r io.Reader) (*Corpus, error) {
+	c := &Corpus{}
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		line := strings.TrimRight(sc.Text(), "\r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if p, ok := hexPrefix(line); ok {
+			c.prefixes = append(c.prefixes, p)
+			continue
+		}
+		c.prefixes = append(c.prefixes, prefix(line))
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	c.sort()
+	return c, nil
+}
+
+// LoadCorpus reads a corpus file in the format accepted by ReadCorpus.
+func LoadCorpus(path string) (*Corpus, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	c, err := ReadCorpus(f)
+	if err != nil {
+		return nil, fmt.Errorf("read %s: %w", path, err)
+	}
+	return c, nil
+}
+
+//go:embed common.txt
+var commonTxt []byte
+
+var (
+	commonOnce sync.Once
+	common     *Corpus
+)
+
+// CommonPasswords returns the bundled list of the most common passwords.
+func CommonPasswords() *Corpus {
+	commonOnce.Do(func() {
+		common, _ = ReadCorpus(bytes.NewReader(commonTxt))
+	})
+	return common
+}
+
+// Contains reports whether pw is in the corpus.
+func (c *Corpus) Contains(pw string) bool {
+	if c == nil {
+		return false
+	}
+	_, found := slices.BinarySearch(c.prefixes, prefix(pw))
+	return found
+}
+
+// Len is the number of distinct entries.
+func (c *Corpus) Len() int {
+	if c == nil {
+		return 0
+	}
+	return len(c.prefixes)
+}
+
+// Merge returns a corpus holding the entries of both c and other.
+func (c *Corpus) Merge(other *Corpus) *Corpus {
+	out := &Corpus{prefixes: make([]uint64, 0, c.Len()+other.Len())}
+	if c != nil {
+		out.prefixes = append(out.prefixes, c.prefixes...)
+	}
+	if other != nil {
+		out.prefixes = append(out.prefixes, other.prefixes...)
+	}
+	out.sort()
+	return out
+}
+
+func (c *Corpus) sort() {
+	slices.Sort(c.prefixes)
+	c.prefixes = slices.Compact(c.prefixes)
+}
+
+func prefix(pw string) uint64 {
+	sum := sha1.Sum([]byte(pw))
+	return binary.BigEndian.Uint64(sum[:8])
+}
+
+func hexPrefix(line string) (uint64, bool) {
+	if i := strings.IndexByte(line, ':'); i >= 0 {
+		line = line[:i]
+	}
+	if len(line) != 2*sha1.Size {
+		return 0, false
+	}
+	b, err := hex.DecodeString(line)
+	if err != nil {
+		return 0, false
+	}
+	return binary.BigEndian.Uint64(b[:8]), true
+}
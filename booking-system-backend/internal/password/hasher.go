@@ -0,0 +1,153 @@
+// Package password hashes and verifies user passwords.
+package password
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/temu-in/temu.in/booking-system-backend/internal/config"
+)
+
+// ErrUnknownFormat is returned for stored hashes no supported algorithm
+// produced.
+var ErrUnknownFormat = errors.New("password: unknown hash format")
+
+// Hasher hashes new passwords and verifies stored ones.
+type Hasher interface {
+	// Hash returns the encoded hash of password.
+	Hash(password string) (string, error)
+	// Verify reports whether password matches encoded. A mismatch is not an
+	// error; malformed or unsupported hashes are.
+	Verify(password, encoded string) (bool, error)
+	// NeedsRehash reports whether encoded was made with another algorithm or
+	// weaker parameters than Hash currently uses.
+	NeedsRehash(encoded string) bool
+}
+
+// Params tunes argon2id. Memory is in KiB.
+type Params struct {
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+// DefaultParams follow the OWASP baseline for argon2id.
+var DefaultParams = Params{Memory: 64 * 1024, Iterations: 3, Parallelism: 2, SaltLength: 16, KeyLength: 32}
+
+// Argon2id hashes with argon2id in PHC string format:
+//
+//	$argon2id$v=19$m=65536,t=3,p=2$<salt>$<hash>
+//
+// It still verifies bcrypt hashes from before the switch; NeedsRehash flags
+// them so they get upgraded on the next successful login.
+type Argon2id struct {
+	Params Params
+}
+
+// NewArgon2id returns a hasher using p.
+func NewArgon2id(p Params) *Argon2id {
+	return &Argon2id{Params: p}
+}
+
+// FromConfig builds the hasher configured through the PASSWORD_ARGON2_*
+// variables, keeping DefaultParams for salt and key length.
+func FromConfig(cfg *config.Config) Hasher {
+	p := DefaultParams
+	p.Memory = cfg.PasswordArgon2Memory
+	p.Iterations = cfg.PasswordArgon2Iterations
+	p.Parallelism = cfg.PasswordArgon2Parallelism
+	return NewArgon2id(p)
+}
+
+func (a *Argon2id) Hash(password string) (string, error) {
+	salt := make([]byte, a.Params.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", fmt.Errorf("password: generate salt: %w", err)
+	}
+	key := argon2.IDKey([]byte(password), salt, a.Params.Iterations, a.Params.Memory, a.Params.Parallelism, a.Params.KeyLength)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, a.Params.Memory, a.Params.Iterations, a.Params.Parallelism,
+		b64.EncodeToString(salt), b64.EncodeToString(key)), nil
+}
+
+func (a *Argon2id) Verify(password, encoded string) (bool, error) {
+	switch {
+	case strings.HasPrefix(encoded, "$argon2id$"):
+		h, err := decodeArgon2id(encoded)
+		if err != nil {
+			return false, err
+		}
+		key := argon2.IDKey([]byte(password), h.salt, h.params.Iterations, h.params.Memory, h.params.Parallelism, uint32(len(h.key)))
+		return subtle.ConstantTimeCompare(key, h.key) == 1, nil
+	case isBcrypt(encoded):
+		err := bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password))
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return false, nil
+		}
+		return err == nil, err
+	default:
+		return false, ErrUnknownFormat
+	}
+}
+
+func (a *Argon2id) NeedsRehash(encoded string) bool {
+	h, err := decodeArgon2id(encoded)
+	if err != nil {
+		return true
+	}
+	return h.version != argon2.Version ||
+		h.params.Memory < a.Params.Memory ||
+		h.params.Iterations < a.Params.Iterations ||
+		h.params.Parallelism != a.Params.Parallelism ||
+		uint32(len(h.salt)) < a.Params.SaltLength ||
+		uint32(len(h.key)) < a.Params.KeyLength
+}
+
+// PHC strings use unpadded standard base64.
+var b64 = base64.RawStdEncoding
+
+type argon2Hash struct {
+	version int
+	params  Params
+	salt    []byte
+	key     []byte
+}
+
+func decodeArgon2id(encoded string) (*argon2Hash, error) {
+	// "", "argon2id", "v=19", "m=..,t=..,p=..", salt, key
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return nil, ErrUnknownFormat
+	}
+	h := &argon2Hash{}
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &h.version); err != nil {
+		return nil, fmt.Errorf("password: argon2id version: %w", err)
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &h.params.Memory, &h.params.Iterations, &h.params.Parallelism); err != nil {
+		return nil, fmt.Errorf("password: argon2id params: %w", err)
+	}
+	var err error
+	if h.salt, err = b64.DecodeString(parts[4]); err != nil {
+		return nil, fmt.Errorf("password: argon2id salt: %w", err)
+	}
+	if h.key, err = b64.DecodeString(parts[5]); err != nil {
+		return nil, fmt.Errorf("password: argon2id key: %w", err)
+	}
+	if len(h.key) == 0 || h.params.Iterations == 0 || h.params.Parallelism == 0 {
+		return nil, ErrUnknownFormat
+	}
+	return h, nil
+}
+
+func isBcrypt(encoded string) bool {
+	return strings.HasPrefix(encoded, "$2a$") || strings.HasPrefix(encoded, "$2b$") || strings.HasPrefix(encoded, "$2y$")
+}
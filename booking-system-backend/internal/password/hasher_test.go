@@ -0,0 +1,136 @@
+package password
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// cheap keeps the tests fast; the format does not depend on the cost.
+var cheap = Params{Memory: 64, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+
+func mustHash(t *testing.T, p Params, pw string) string {
+	t.Helper()
+	encoded, err := NewArgon2id(p).Hash(pw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return encoded
+}
+
+func mustBcrypt(t *testing.T, pw string) string {
+	t.Helper()
+	b, err := bcrypt.GenerateFromPassword([]byte(pw), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func TestArgon2idHashFormat(t *testing.T) {
+	encoded := mustHash(t, cheap, "correct horse")
+	if !strings.HasPrefix(encoded, "$argon2id$v=19$m=64,t=1,p=1$") {
+		t.Errorf("encoded = %q", encoded)
+	}
+	h, err := decodeArgon2id(encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.params.Memory != 64 || h.params.Iterations != 1 || h.params.Parallelism != 1 || len(h.salt) != 16 || len(h.key) != 32 {
+		t.Errorf("decoded %+v", h)
+	}
+	if encoded == mustHash(t, cheap, "correct horse") {
+		t.Error("two hashes of the same password share a salt")
+	}
+}
+
+func TestArgon2idVerify(t *testing.T) {
+	const pw = "correct horse"
+	good := mustHash(t, cheap, pw)
+	parts := strings.Split(good, "$")
+	with := func(i int, v string) string {
+		p := append([]string(nil), parts...)
+		p[i] = v
+		return strings.Join(p, "$")
+	}
+	// a key of the right length that is not the password's
+	otherKey := strings.Split(mustHash(t, cheap, "something else"), "$")[5]
+
+	cases := []struct {
+		name    string
+		pw      string
+		encoded string
+		want    bool
+		wantErr bool
+	}{
+		{"argon2id match", pw, good, true, false},
+		{"argon2id mismatch", "wrong", good, false, false},
+		{"bcrypt match", pw, mustBcrypt(t, pw), true, false},
+		{"bcrypt mismatch", "wrong", mustBcrypt(t, pw), false, false},
+		{"tampered iterations", pw, with(3, "m=64,t=2,p=1"), false, false},
+		{"tampered memory", pw, with(3, "m=128,t=1,p=1"), false, false},
+		{"tampered key", pw, with(5, otherKey), false, false},
+		{"empty", pw, "", false, true},
+		{"plaintext", pw, pw, false, true},
+		{"argon2i", pw, with(1, "argon2i"), false, true},
+		{"missing key", pw, strings.Join(parts[:5], "$"), false, true},
+		{"bad version", pw, with(2, "v=x"), false, true},
+		{"bad params", pw, with(3, "m=64,t=1"), false, true},
+		{"zero iterations", pw, with(3, "m=64,t=0,p=1"), false, true},
+		{"bad salt", pw, with(4, "not base64!"), false, true},
+		{"empty key", pw, with(5, ""), false, true},
+		{"broken bcrypt", pw, "$2a$10$short", false, true},
+	}
+	a := NewArgon2id(cheap)
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := a.Verify(tc.pw, tc.encoded)
+			if got != tc.want || (err != nil) != tc.wantErr {
+				t.Errorf("Verify = %v, %v; want %v, error %v", got, err, tc.want, tc.wantErr)
+			}
+		})
+	}
+	if _, err := a.Verify(pw, "plain"); !errors.Is(err, ErrUnknownFormat) {
+		t.Errorf("unknown format: err = %v", err)
+	}
+}
+
+func TestArgon2idNeedsRehash(t *testing.T) {
+	stronger := cheap
+	stronger.Memory, stronger.Iterations = 128, 2
+	otherLanes := cheap
+	otherLanes.Parallelism = 2
+	shortSalt := cheap
+	shortSalt.SaltLength = 8
+
+	cases := []struct {
+		name    string
+		encoded string
+		want    bool
+	}{
+		{"current", mustHash(t, cheap, "pw"), false},
+		{"stronger", mustHash(t, stronger, "pw"), false},
+		{"weaker", mustHash(t, Params{Memory: 32, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}, "pw"), true},
+		{"other parallelism", mustHash(t, otherLanes, "pw"), true},
+		{"short salt", mustHash(t, shortSalt, "pw"), true},
+		{"old version", strings.Replace(mustHash(t, cheap, "pw"), "v=19", "v=16", 1), true},
+		{"bcrypt", mustBcrypt(t, "pw"), true},
+		{"malformed", "$argon2id$v=19$garbage", true},
+		{"empty", "", true},
+	}
+	a := NewArgon2id(cheap)
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := a.NeedsRehash(tc.encoded); got != tc.want {
+				t.Errorf("NeedsRehash = %v, want %v", got, tc.want)
+			}
+		})
+	}
+
+	// raising the cost flags hashes made before
+	if !NewArgon2id(stronger).NeedsRehash(mustHash(t, cheap, "pw")) {
+		t.Error("a hash with fewer iterations and less memory is not flagged")
+	}
+}
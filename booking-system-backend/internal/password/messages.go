@@ -0,0 +1,50 @@
+package password
+
+import (
+	"fmt"
+	"strings"
+)
+
+// DefaultLocale is used when the client asks for nothing we translate.
+const DefaultLocale = "en"
+
+var messages = map[string]map[string]string{
+	"en": {
+		ReasonTooShort: "Use at least {min} characters.",
+		ReasonTooLong:  "Use at most {max} characters.",
+		ReasonContext:  "Don't use \"{word}\" or other parts of your name or email address.",
+		ReasonBreached: "This password has appeared in a data breach. Choose a different one.",
+	},
+	"id": {
+		ReasonTooShort: "Gunakan minimal {min} karakter.",
+		ReasonTooLong:  "Gunakan maksimal {max} karakter.",
+		ReasonContext:  "Jangan gunakan \"{word}\" atau bagian lain dari nama atau alamat email Anda.",
+		ReasonBreached: "Kata sandi ini pernah bocor dalam insiden keamanan data. Pilih kata sandi lain.",
+	},
+}
+
+// Locale picks the best supported language from an Accept-Language header.
+func Locale(acceptLanguage string) string {
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		tag, _, _ := strings.Cut(strings.TrimSpace(part), ";")
+		lang, _, _ := strings.Cut(strings.ToLower(tag), "-")
+		if _, ok := messages[lang]; ok {
+			return lang
+		}
+	}
+	return DefaultLocale
+}
+
+// message renders the text for code, substituting {name} placeholders from
+// params.
+func message(locale, code string, params map[string]any) string {
+	table, ok := messages[locale]
+	if !ok {
+		table = messages[DefaultLocale]
+	}
+	text := table[code]
+	for k, v := range params {
+		text = strings.ReplaceAll(text, "{"+k+"}", fmt.Sprint(v))
+	}
+	return text
+}
@@ -0,0 +1,114 @@
+package password
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/temu-in/temu.in/booking-system-backend/internal/config"
+)
+
+// Reason codes reported by Policy.Check. The frontend can key its own copy on
+// them; Message carries a server-side translation.
+const (
+	ReasonTooShort = "too_short"
+	ReasonTooLong  = "too_long"
+	ReasonContext  = "contains_personal_info"
+	ReasonBreached = "breached"
+)
+
+// Reason is one rule a candidate password broke.
+type Reason struct {
+	Code    string         `json:"code"`
+	Message string         `json:"message"`
+	Params  map[string]any `json:"params,omitempty"`
+}
+
+// Policy decides whether a new password is acceptable.
+type Policy struct {
+	MinLength int
+	MaxLength int
+	// Words is always blocked, in addition to the per-user context passed to
+	// Check.
+	Words []string
+	// Breached is consulted last; nil skips the check.
+	Breached *Corpus
+}
+
+// DefaultPolicy is used when nothing else is configured: 8 to 128 characters,
+// no "temu", and not one of the bundled common passwords.
+func DefaultPolicy() *Policy {
+	return &Policy{MinLength: 8, MaxLength: 128, Words: []string{"temu"}, Breached: CommonPasswords()}
+}
+
+// PolicyFromConfig builds the policy from the PASSWORD_* settings. When
+// PASSWORD_BREACHED_FILE is set its entries are checked on top of the bundled
+// list.
+func PolicyFromConfig(cfg *config.Config) (*Policy, error) {
+	p := DefaultPolicy()
+	p.MinLength = cfg.PasswordMinLength
+	p.Words = append(p.Words, cfg.PasswordBlockedWords...)
+	if cfg.PasswordBreachedFile != "" {
+		extra, err := LoadCorpus(cfg.PasswordBreachedFile)
+		if err != nil {
+			return nil, fmt.Errorf("load breached passwords: %w", err)
+		}
+		p.Breached = p.Breached.Merge(extra)
+	}
+	return p, nil
+}
+
+// Check returns every reason pw is rejected, localized for locale, or nil when
+// it is acceptable. context holds user-specific strings such as the email
+// address and name; pieces of them may not appear in the password.
+func (p *Policy) Check(pw, locale string, context ...string) []Reason {
+	var out []Reason
+	add := func(code string, params map[string]any) {
+		out = append(out, Reason{Code: code, Message: message(locale, code, params), Params: params})
+	}
+
+	n := utf8.RuneCountInString(pw)
+	if n < p.MinLength {
+		add(ReasonTooShort, map[string]any{"min": p.MinLength})
+	}
+	if p.MaxLength > 0 && n > p.MaxLength {
+		add(ReasonTooLong, map[string]any{"max": p.MaxLength})
+	}
+	if w := p.contextWord(pw, context); w != "" {
+		add(ReasonContext, map[string]any{"word": w})
+	}
+	// capitalising a breached password does not make it any safer
+	if p.Breached.Contains(pw) || p.Breached.Contains(strings.ToLower(pw)) {
+		add(ReasonBreached, nil)
+	}
+	return out
+}
+
+// contextWord returns the first blocked word contained in pw, ignoring case.
+func (p *Policy) contextWord(pw string, context []string) string {
+	lower := strings.ToLower(pw)
+	words := append([]string{}, p.Words...)
+	for _, s := range context {
+		words = append(words, contextWords(s)...)
+	}
+	for _, w := range words {
+		w = strings.ToLower(w)
+		// very short fragments would block too many ordinary passwords
+		if utf8.RuneCountInString(w) >= 3 && strings.Contains(lower, w) {
+			return w
+		}
+	}
+	return ""
+}
+
+// contextWords splits e.g. "jane.doe@example.com" or "Jane Doe" into its
+// alphanumeric parts, dropping the top-level domain.
+func contextWords(s string) []string {
+	if at := strings.LastIndex(s, "@"); at >= 0 {
+		if dot := strings.LastIndex(s, "."); dot > at {
+			s = s[:dot]
+		}
+	}
+	return strings.FieldsFunc(s, func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsDigit(r) })
+}
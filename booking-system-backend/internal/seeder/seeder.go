@@ -1,34 +1,40 @@
 package seeder
 
 import (
-    "os"
-    "log"
+	"fmt"
+	"log"
+	"os"
 
-    "golang.org/x/crypto/bcrypt"
-    "gorm.io/gorm"
+	"gorm.io/gorm"
 
-    "github.com/temu-in/temu.in/booking-system-backend/internal/models"
+	"github.com/temu-in/temu.in/booking-system-backend/internal/models"
+	"github.com/temu-in/temu.in/booking-system-backend/internal/password"
 )
 
-func SeedAdmin(db *gorm.DB) error {
-    if os.Getenv("ADMIN_SEED") != "true" {
-        return nil
-    }
+// SeedAdmin creates the admin account from ADMIN_EMAIL/ADMIN_PASSWORD when
+// ADMIN_SEED=true and the account does not exist yet.
+func SeedAdmin(db *gorm.DB, hasher password.Hasher) error {
+	if os.Getenv("ADMIN_SEED") != "true" {
+		return nil
+	}
 
-    email := os.Getenv("ADMIN_EMAIL")
-    password := os.Getenv("ADMIN_PASSWORD")
-    if email == "" || password == "" {
-        log.Println("ADMIN_SEED=true but ADMIN_EMAIL/ADMIN_PASSWORD not set; skipping admin seed")
-        return nil
-    }
+	email := os.Getenv("ADMIN_EMAIL")
+	pass := os.Getenv("ADMIN_PASSWORD")
+	if email == "" || pass == "" {
+		log.Println("ADMIN_SEED=true but ADMIN_EMAIL/ADMIN_PASSWORD not set; skipping admin seed")
+		return nil
+	}
 
-    var u models.User
-    if err := db.Where("email = ?", email).First(&u).Error; err == nil {
-        // user exists
-        return nil
-    }
+	var u models.User
+	if err := db.Where("email = ?", email).First(&u).Error; err == nil {
+		// user exists
+		return nil
+	}
 
-    pw, _ := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
-    admin := &models.User{Email: email, Password: string(pw), Name: "Admin", Role: "admin"}
-    return db.Create(admin).Error
+	pw, err := hasher.Hash(pass)
+	if err != nil {
+		return fmt.Errorf("hash admin password: %w", err)
+	}
+	admin := &models.User{Email: email, Password: pw, Name: "Admin", Role: models.RoleAdmin, IsVerified: true}
+	return db.Create(admin).Error
 }
@@ -2,7 +2,15 @@ package server
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"sync"
+	"syscall"
 	"time"
 
 	"github.com/gin-contrib/cors"
@@ -11,31 +19,43 @@ import (
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 
+	"github.com/temu-in/temu.in/booking-system-backend/internal/admin"
+	"github.com/temu-in/temu.in/booking-system-backend/internal/audit"
+	authhandler "github.com/temu-in/temu.in/booking-system-backend/internal/auth"
 	"github.com/temu-in/temu.in/booking-system-backend/internal/config"
 	"github.com/temu-in/temu.in/booking-system-backend/internal/health"
+	"github.com/temu-in/temu.in/booking-system-backend/internal/mail"
 	"github.com/temu-in/temu.in/booking-system-backend/internal/models"
-	authhandler "github.com/temu-in/temu.in/booking-system-backend/internal/auth"
-	"github.com/temu-in/temu.in/booking-system-backend/internal/user"
-	"github.com/temu-in/temu.in/booking-system-backend/internal/admin"
-	"github.com/temu-in/temu.in/booking-system-backend/internal/audit"
+	"github.com/temu-in/temu.in/booking-system-backend/internal/password"
 	"github.com/temu-in/temu.in/booking-system-backend/internal/seeder"
 	"github.com/temu-in/temu.in/booking-system-backend/internal/token"
+	"github.com/temu-in/temu.in/booking-system-backend/internal/user"
 )
 
 type Server struct {
-	cfg    *config.Config
-	router *gin.Engine
-	db     *gorm.DB
-	cache  *redis.Client
+	cfg        *config.Config
+	router     *gin.Engine
+	db         *gorm.DB
+	cache      *redis.Client
+	subscriber *token.Subscriber
+	auth       *authhandler.Handler
 }
 
 func New(cfg *config.Config) *Server {
 	r := gin.New()
+	// gin trusts X-Forwarded-For from anyone unless told otherwise, which would
+	// let clients pick the IP every per-IP limit is keyed on
+	if err := r.SetTrustedProxies(cfg.TrustedProxies); err != nil {
+		log.Printf("trusted proxies: %v; trusting none", err)
+		_ = r.SetTrustedProxies(nil)
+	}
 	r.Use(gin.Logger(), gin.Recovery())
+	// the refresh cookie needs credentialed CORS, which rules out "*"
 	r.Use(cors.New(cors.Config{
-		AllowOrigins: []string{"*"},
-		AllowMethods: []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
-		AllowHeaders: []string{"Origin", "Content-Type", "Authorization"},
+		AllowOrigins:     authhandler.TrustedOrigins(cfg),
+		AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
+		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization"},
+		AllowCredentials: true,
 	}))
 
 	srv := &Server{cfg: cfg, router: r}
@@ -47,17 +67,55 @@ func (s *Server) registerRoutes() {
 	health.RegisterRoutes(s.router)
 }
 
+// Run serves HTTP until the process receives SIGINT or SIGTERM, then drains
+// in-flight requests and the work they left running, and stops background
+// workers before returning.
 func (s *Server) Run() error {
-	if err := s.connectDatabase(); err != nil {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// redis first: the repositories and denylist wired in connectDatabase use it
+	if err := s.connectRedis(); err != nil {
 		return err
 	}
+	defer s.cache.Close()
 
-	if err := s.connectRedis(); err != nil {
+	if err := s.connectDatabase(); err != nil {
 		return err
 	}
 
-	addr := fmt.Sprintf(":%d", s.cfg.Port)
-	return s.router.Run(addr)
+	var workers sync.WaitGroup
+	if s.subscriber != nil {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			s.subscriber.Run(ctx)
+		}()
+	}
+
+	httpSrv := &http.Server{Addr: fmt.Sprintf(":%d", s.cfg.Port), Handler: s.router}
+	serveErr := make(chan error, 1)
+	go func() { serveErr <- httpSrv.ListenAndServe() }()
+
+	var err error
+	select {
+	case err = <-serveErr:
+	case <-ctx.Done():
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		err = httpSrv.Shutdown(shutdownCtx)
+		// emails queued by requests that just finished
+		if derr := s.auth.Drain(shutdownCtx); derr != nil {
+			log.Printf("background work still running at exit: %v", derr)
+		}
+	}
+	stop()
+	workers.Wait()
+
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
 }
 
 func (s *Server) connectDatabase() error {
@@ -68,29 +126,101 @@ func (s *Server) connectDatabase() error {
 
 	s.db = db
 	// auto-migrate core models
-	if err := s.db.AutoMigrate(&models.User{}, &models.RefreshToken{}, &models.AdminAudit{}); err != nil {
+	if err := user.MigrateVerification(s.db); err != nil {
+		return fmt.Errorf("migrate email verification: %w", err)
+	}
+	if err := s.db.AutoMigrate(&models.User{}, &models.RefreshToken{}, &models.AdminAudit{}, &models.AuditChainHead{}, &models.ActionToken{}, &models.SecurityEvent{}, &models.RecoveryCode{}, &models.APIKey{}, &models.Passkey{}, &models.Identity{}); err != nil {
 		return fmt.Errorf("auto migrate: %w", err)
 	}
+	if err := user.MigrateRoles(s.db); err != nil {
+		return fmt.Errorf("migrate roles: %w", err)
+	}
+	if err := user.MigrateSearchIndexes(s.db); err != nil {
+		log.Printf("user search indexes: %v", err)
+	}
+	if err := audit.Migrate(s.db); err != nil {
+		return fmt.Errorf("migrate audit log: %w", err)
+	}
 
 	// register auth routes after DB connected
 	repo := user.NewRepository(s.db)
 	var tokenRepo *token.Repository
 	if s.cache != nil {
 		tokenRepo = token.NewRepositoryWithCache(s.db, s.cache)
+		s.subscriber = token.NewSubscriber(s.cache)
+		revocations := token.NewRevocationCache()
+		revocations.Attach(s.subscriber)
+		tokenRepo.UseRevocationCache(revocations)
 	} else {
 		tokenRepo = token.NewRepository(s.db)
 	}
-	h := authhandler.NewHandler(repo, s.cfg, tokenRepo)
+	auditRepo := audit.NewRepository(s.db)
+	keys, err := authhandler.KeyringFromConfig(s.cfg)
+	if err != nil {
+		return fmt.Errorf("load jwt keys: %w", err)
+	}
+	s.router.GET("/.well-known/jwks.json", authhandler.JWKSHandler(keys))
+	denylist := authhandler.NewDenylist(s.cache, s.cfg.AccessTokenTTL)
+	if s.subscriber != nil {
+		denylist.Attach(s.subscriber)
+	}
+	versions := authhandler.NewVersionCache(repo.SecurityVersion, s.cache)
+	repo.OnSecurityVersionChange(versions.Changed)
+	if s.subscriber != nil {
+		versions.Attach(s.subscriber)
+	}
+	requireAuth := authhandler.Middleware(keys,
+		authhandler.CheckDenylist(denylist),
+		authhandler.CheckSecurityVersion(versions),
+		authhandler.AcceptAPIKeys(tokenRepo, repo),
+		authhandler.AuditImpersonation(auditRepo),
+	)
+	limiter := authhandler.NewLoginLimiter(s.cache, authhandler.LockoutPolicy{
+		MaxPerEmail: s.cfg.LoginMaxPerEmail,
+		MaxPerIP:    s.cfg.LoginMaxPerIP,
+		Window:      s.cfg.LoginFailWindow,
+		Base:        s.cfg.LoginLockoutBase,
+		Max:         s.cfg.LoginLockoutMax,
+	})
+	hasher := password.FromConfig(s.cfg)
+	policy, err := password.PolicyFromConfig(s.cfg)
+	if err != nil {
+		return err
+	}
+	passkeys, err := authhandler.NewPasskeys(s.cfg, s.cache)
+	if err != nil {
+		return fmt.Errorf("configure passkeys: %w", err)
+	}
+	h := authhandler.NewHandler(repo, s.cfg, tokenRepo, keys,
+		authhandler.WithPasswordHasher(hasher),
+		authhandler.WithPasswordPolicy(policy),
+		authhandler.WithMailer(s.mailer()),
+		authhandler.WithAuditLog(auditRepo),
+		authhandler.WithDenylist(denylist),
+		authhandler.WithLoginLimiter(limiter),
+		authhandler.WithPasskeys(passkeys),
+		authhandler.WithOIDC(authhandler.OIDCFromConfig(s.cfg, s.cache)),
+		authhandler.WithPasswordResetLimiter(authhandler.NewPasswordResetLimiter(s.cache, s.cfg.PasswordResetCooldown, s.cfg.PasswordResetMaxPerIP, s.cfg.PasswordResetWindow)),
+		authhandler.WithVerificationLimiter(authhandler.NewVerificationLimiter(s.cache, s.cfg.VerificationResendCooldown, s.cfg.VerificationResendMaxPerIP, s.cfg.VerificationResendWindow)),
+		authhandler.WithMagicLinkLimiter(authhandler.NewMagicLinkLimiter(s.cache, s.cfg.MagicLinkCooldown, s.cfg.MagicLinkMaxPerIP, s.cfg.MagicLinkWindow)),
+	)
+	s.auth = h
 	api := s.router.Group("/api")
-	h.RegisterRoutes(api.Group("/auth"))
+	h.RegisterRoutes(api.Group("/auth", authhandler.CheckOrigin(authhandler.TrustedOrigins(s.cfg))), requireAuth)
 
 	// seed admin if requested
-	if err := seeder.SeedAdmin(s.db); err != nil {
+	if err := seeder.SeedAdmin(s.db, hasher); err != nil {
 		return fmt.Errorf("seed admin: %w", err)
 	}
 
+	rolePolicy, err := authhandler.RolePolicyFromConfig(s.cfg)
+	if err != nil {
+		return fmt.Errorf("load authz policy: %w", err)
+	}
+	authz := authhandler.NewAuthorizer(rolePolicy, auditRepo)
+
 	// register /api/me (inline to avoid import cycles)
-	api.GET("/me", authhandler.Middleware(s.cfg.JWTSecret), func(c *gin.Context) {
+	api.GET("/me", requireAuth, authhandler.RequireScope(authhandler.ScopeProfileRead), func(c *gin.Context) {
 		v, ok := c.Get(authhandler.UserContextKey)
 		if !ok {
 			c.JSON(401, gin.H{"error": "unauthenticated"})
@@ -106,22 +236,81 @@ func (s *Server) connectDatabase() error {
 			c.JSON(500, gin.H{"error": "internal"})
 			return
 		}
-		c.JSON(200, gin.H{"user": gin.H{"id": u.ID, "email": u.Email, "role": u.Role, "name": u.Name}})
+		resp := gin.H{"user": profile(u)}
+		if claims.IsImpersonation() {
+			// lets the client show who is really signed in
+			resp["impersonated_by"] = claims.Act.UserID
+		}
+		c.JSON(200, resp)
 	})
 
+	// a user's profile by id: users may read their own, staff with users:read
+	// anyone's
+	api.GET("/users/:id", requireAuth, authhandler.RequireScope(authhandler.ScopeProfileRead),
+		authz.RequireOwnership(authhandler.PermUsersReadOwn, authhandler.PermUsersRead, authhandler.UserIDParam("id")),
+		userProfile(repo))
+
+	me := api.Group("/me", requireAuth, authhandler.RequireSession())
+	h.RegisterSessionRoutes(me)
+	h.RegisterAPIKeyRoutes(me)
+	h.RegisterPasskeyRoutes(me)
+	h.RegisterIdentityRoutes(me)
+
+	// booking routes mount on this group; with UNVERIFIED_POLICY=booking it
+	// turns away users whose email is not verified
+	bookings := api.Group("/bookings", requireAuth, authhandler.RequireVerified(repo, s.cfg.UnverifiedPolicy))
+	// lets clients check up front whether the user may book
+	bookings.GET("/eligibility", authz.RequirePermission(authhandler.PermBookingsCreate), func(c *gin.Context) { c.JSON(200, gin.H{"status": "ok"}) })
+
 	// admin endpoints
-	auditRepo := audit.NewRepository(s.db)
-	adminHandler := admin.NewHandler(repo, auditRepo)
-	adminHandler.RegisterRoutes(api.Group("/"), s.cfg.JWTSecret)
+	adminHandler := admin.NewHandler(repo, auditRepo, tokenRepo, denylist, limiter, authz, authhandler.NewImpersonator(keys, s.cfg.ImpersonationTTL))
+	var adminExtra []gin.HandlerFunc
+	if s.cfg.MFARequiredForAdmin {
+		adminExtra = append(adminExtra, authhandler.RequireMFA())
+	}
+	adminHandler.RegisterRoutes(api.Group("/"), requireAuth, adminExtra...)
 
 	// sample admin-only route
 	adminGroup := api.Group("/admin")
-	adminGroup.Use(authhandler.Middleware(s.cfg.JWTSecret), authhandler.RequireRole("admin"))
+	adminGroup.Use(requireAuth, authz.RequireStaff())
+	adminGroup.Use(adminExtra...)
+	adminGroup.Use(authhandler.RequireScope(authhandler.ScopeAdminAudit), authz.RequirePermission(authhandler.PermAuditRead))
 	adminGroup.GET("/stats", func(c *gin.Context) { c.JSON(200, gin.H{"status": "ok", "users": 42}) })
 
 	return nil
 }
 
+// userProfile serves GET /users/:id once access has been checked.
+func userProfile(repo *user.Repository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, _ := strconv.ParseUint(c.Param("id"), 10, 64)
+		u, err := repo.FindByID(uint(id))
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(404, gin.H{"error": "user not found"})
+			return
+		}
+		if err != nil {
+			c.JSON(500, gin.H{"error": "internal"})
+			return
+		}
+		c.JSON(200, gin.H{"user": profile(u)})
+	}
+}
+
+// profile is the view of a user returned by /api/me and /api/users/:id.
+func profile(u *models.User) gin.H {
+	return gin.H{"id": u.ID, "email": u.Email, "role": u.Role, "name": u.Name, "is_verified": u.IsVerified, "totp_enabled": u.TOTPEnabled}
+}
+
+// mailer picks SendGrid when an API key is configured and falls back to
+// logging messages otherwise.
+func (s *Server) mailer() mail.Sender {
+	if s.cfg.SendGridAPIKey != "" {
+		return mail.NewSendGridSender(s.cfg.SendGridAPIKey, s.cfg.MailFrom)
+	}
+	return mail.LogSender{}
+}
+
 func (s *Server) connectRedis() error {
 	options, err := redis.ParseURL(s.cfg.RedisURL)
 	if err != nil {
@@ -0,0 +1,53 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"github.com/temu-in/temu.in/booking-system-backend/internal/models"
+	"github.com/temu-in/temu.in/booking-system-backend/internal/user"
+)
+
+func TestUserProfile(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+	if err := db.AutoMigrate(&models.User{}); err != nil {
+		t.Fatal(err)
+	}
+	repo := user.NewRepository(db)
+	if err := repo.Create(&models.User{Email: "ana@example.com", Role: models.RoleCustomer}); err != nil {
+		t.Fatal(err)
+	}
+	r := gin.New()
+	r.GET("/users/:id", userProfile(repo))
+
+	cases := []struct {
+		name string
+		path string
+		want int
+	}{
+		{"found", "/users/1", http.StatusOK},
+		{"missing", "/users/99", http.StatusNotFound},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tc.path, nil))
+			if w.Code != tc.want {
+				t.Errorf("status = %d, want %d; body %s", w.Code, tc.want, w.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,71 @@
+package token
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/temu-in/temu.in/booking-system-backend/internal/models"
+)
+
+const (
+	PurposePasswordReset     = "password_reset"
+	PurposeEmailVerification = "email_verification"
+	PurposeMFAChallenge      = "mfa_challenge"
+	PurposeMagicLink         = "magic_link"
+)
+
+// ErrActionTokenInvalid is returned when a single-use token is unknown,
+// expired, already used or issued for a different purpose.
+var ErrActionTokenInvalid = errors.New("invalid or expired token")
+
+func (r *Repository) CreateAction(t *models.ActionToken) error {
+	return r.db.Create(t).Error
+}
+
+// ConsumeAction marks a single-use token as used and returns it. The update is
+// conditional so two concurrent requests cannot both consume the same token.
+func (r *Repository) ConsumeAction(hash, purpose string) (*models.ActionToken, error) {
+	now := time.Now()
+	res := r.db.Model(&models.ActionToken{}).
+		Where("token_hash = ? AND purpose = ? AND used_at IS NULL AND expires_at > ?", hash, purpose, now).
+		Update("used_at", now)
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	if res.RowsAffected == 0 {
+		return nil, ErrActionTokenInvalid
+	}
+
+	var t models.ActionToken
+	if err := r.db.Where("token_hash = ?", hash).First(&t).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrActionTokenInvalid
+		}
+		return nil, err
+	}
+	return &t, nil
+}
+
+// InvalidateActions burns every outstanding token of the given purpose for a
+// user, so only the most recently issued one can be used.
+func (r *Repository) InvalidateActions(userID uint, purpose string) error {
+	return r.db.Model(&models.ActionToken{}).
+		Where("user_id = ? AND purpose = ? AND used_at IS NULL", userID, purpose).
+		Update("used_at", time.Now()).Error
+}
+
+// FindAction returns a live token without consuming it, for flows that allow
+// a few attempts before the token is spent (e.g. an MFA challenge).
+func (r *Repository) FindAction(hash, purpose string) (*models.ActionToken, error) {
+	var t models.ActionToken
+	err := r.db.Where("token_hash = ? AND purpose = ? AND used_at IS NULL AND expires_at > ?", hash, purpose, time.Now()).First(&t).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrActionTokenInvalid
+		}
+		return nil, err
+	}
+	return &t, nil
+}
@@ -0,0 +1,71 @@
+package token
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/temu-in/temu.in/booking-system-backend/internal/models"
+)
+
+// lastUsedResolution limits how often using a key writes to the database.
+const lastUsedResolution = time.Minute
+
+func (r *Repository) CreateAPIKey(k *models.APIKey) error {
+	return r.db.Create(k).Error
+}
+
+// FindAPIKey returns the live key with the given hash, or nil when it is
+// unknown, revoked or expired.
+func (r *Repository) FindAPIKey(hash string) (*models.APIKey, error) {
+	var k models.APIKey
+	err := r.db.Where("key_hash = ? AND revoked_at IS NULL AND expires_at > ?", hash, time.Now()).First(&k).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &k, nil
+}
+
+// ListAPIKeys returns every key of the user that has not been revoked,
+// newest first. Expired keys are included so users can see why one stopped
+// working.
+func (r *Repository) ListAPIKeys(userID uint) ([]models.APIKey, error) {
+	var out []models.APIKey
+	if err := r.db.Where("user_id = ? AND revoked_at IS NULL", userID).Order("created_at desc").Find(&out).Error; err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// RevokeAPIKey revokes one key of the user. It reports false when the key does
+// not exist, is already revoked or belongs to someone else.
+func (r *Repository) RevokeAPIKey(userID, id uint) (bool, error) {
+	res := r.db.Model(&models.APIKey{}).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL", id, userID).
+		Update("revoked_at", time.Now())
+	if res.Error != nil {
+		return false, res.Error
+	}
+	return res.RowsAffected > 0, nil
+}
+
+// RevokeAllAPIKeys revokes every active key of the user.
+func (r *Repository) RevokeAllAPIKeys(userID uint) error {
+	return r.db.Model(&models.APIKey{}).
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Update("revoked_at", time.Now()).Error
+}
+
+// TouchAPIKey records that the key was just used. Writes are skipped while the
+// stored time is less than lastUsedResolution old.
+func (r *Repository) TouchAPIKey(k *models.APIKey) error {
+	now := time.Now()
+	if k.LastUsedAt != nil && now.Sub(*k.LastUsedAt) < lastUsedResolution {
+		return nil
+	}
+	return r.db.Model(&models.APIKey{}).Where("id = ?", k.ID).Update("last_used_at", now).Error
+}
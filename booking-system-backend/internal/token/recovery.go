@@ -0,0 +1,44 @@
+package token
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/temu-in/temu.in/booking-system-backend/internal/models"
+)
+
+// ReplaceRecoveryCodes drops every recovery code of the user and stores the
+// given hashes instead.
+func (r *Repository) ReplaceRecoveryCodes(userID uint, hashes []string) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error; err != nil {
+			return err
+		}
+		codes := make([]models.RecoveryCode, len(hashes))
+		for i, h := range hashes {
+			codes[i] = models.RecoveryCode{UserID: userID, CodeHash: h}
+		}
+		if len(codes) == 0 {
+			return nil
+		}
+		return tx.Create(&codes).Error
+	})
+}
+
+// ConsumeRecoveryCode burns an unused code and reports whether it was valid.
+func (r *Repository) ConsumeRecoveryCode(userID uint, hash string) (bool, error) {
+	res := r.db.Model(&models.RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, hash).
+		Update("used_at", time.Now())
+	if res.Error != nil {
+		return false, res.Error
+	}
+	return res.RowsAffected == 1, nil
+}
+
+func (r *Repository) CountRecoveryCodes(userID uint) (int64, error) {
+	var n int64
+	err := r.db.Model(&models.RecoveryCode{}).Where("user_id = ? AND used_at IS NULL", userID).Count(&n).Error
+	return n, err
+}
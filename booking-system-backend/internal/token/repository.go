@@ -1,76 +1,183 @@
 package token
 
 import (
-    "context"
-    "fmt"
-    "time"
+	"context"
+	"errors"
+	"fmt"
+	"time"
 
-    "github.com/redis/go-redis/v9"
-    "gorm.io/gorm"
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
 
-    "github.com/temu-in/temu.in/booking-system-backend/internal/models"
+	"github.com/temu-in/temu.in/booking-system-backend/internal/models"
 )
 
-type Repository struct{
-    db *gorm.DB
-    cache *redis.Client // optional redis client for blacklist / notifications
+type Repository struct {
+	db          *gorm.DB
+	cache       *redis.Client    // optional redis client for blacklist / notifications
+	revocations *RevocationCache // optional in-memory view fed by a Subscriber
 }
 
 func NewRepository(db *gorm.DB) *Repository {
-    return &Repository{db: db}
+	return &Repository{db: db}
 }
 
 // NewRepositoryWithCache creates a token repository with an attached Redis client
 func NewRepositoryWithCache(db *gorm.DB, cache *redis.Client) *Repository {
-    return &Repository{db: db, cache: cache}
+	return &Repository{db: db, cache: cache}
+}
+
+// UseRevocationCache lets lookups consult rc before Redis. While rc is synced
+// the Redis blacklist check is skipped entirely.
+func (r *Repository) UseRevocationCache(rc *RevocationCache) {
+	r.revocations = rc
 }
 
 func (r *Repository) Create(t *models.RefreshToken) error {
-    return r.db.Create(t).Error
+	return r.db.Create(t).Error
 }
 
 func (r *Repository) RevokeByHash(hash string) error {
-    if err := r.db.Model(&models.RefreshToken{}).Where("token_hash = ?", hash).Update("revoked", true).Error; err != nil {
-        return err
-    }
-    // add to redis blacklist for fast checks (set key with TTL equal to token expiry window)
-    if r.cache != nil {
-        ctx := context.Background()
-        key := fmt.Sprintf("revoked_rt:%s", hash)
-        // store a simple value; set TTL to 30 days as a conservative upper bound
-        _ = r.cache.Set(ctx, key, "1", 30*24*time.Hour).Err()
-        // publish notification for other instances (best-effort)
-        _ = r.cache.Publish(ctx, "revoked_refresh", hash).Err()
-    }
-    return nil
+	if err := r.db.Model(&models.RefreshToken{}).Where("token_hash = ?", hash).Update("revoked", true).Error; err != nil {
+		return err
+	}
+	r.markRevoked(hash)
+	return nil
+}
+
+// markRevoked adds a hash to the redis blacklist and notifies other instances.
+func (r *Repository) markRevoked(hash string) {
+	if r.revocations != nil {
+		r.revocations.AddHash(hash)
+	}
+	// add to redis blacklist for fast checks (set key with TTL equal to token expiry window)
+	if r.cache != nil {
+		ctx := context.Background()
+		key := revokedRefreshPrefix + hash
+		// store a simple value; set TTL to 30 days as a conservative upper bound
+		_ = r.cache.Set(ctx, key, "1", revokedRefreshTTL).Err()
+		// publish notification for other instances (best-effort)
+		_ = r.cache.Publish(ctx, ChannelRevokedRefresh, hash).Err()
+	}
 }
 
 func (r *Repository) FindByHash(hash string) (*models.RefreshToken, error) {
-    // quick check in redis blacklist
-    if r.cache != nil {
-        ctx := context.Background()
-        key := fmt.Sprintf("revoked_rt:%s", hash)
-        if exists, _ := r.cache.Exists(ctx, key).Result(); exists > 0 {
-            // treat as not found / revoked
-            return nil, gorm.ErrRecordNotFound
-        }
-    }
-
-    var t models.RefreshToken
-    if err := r.db.Where("token_hash = ?", hash).First(&t).Error; err != nil {
-        return nil, err
-    }
-    return &t, nil
+	if r.revocations != nil && r.revocations.HashRevoked(hash) {
+		return nil, gorm.ErrRecordNotFound
+	}
+	// quick check in redis blacklist, unless the local cache is known complete
+	if r.cache != nil && !(r.revocations != nil && r.revocations.Synced()) {
+		ctx := context.Background()
+		key := revokedRefreshPrefix + hash
+		if exists, _ := r.cache.Exists(ctx, key).Result(); exists > 0 {
+			// treat as not found / revoked
+			return nil, gorm.ErrRecordNotFound
+		}
+	}
+
+	var t models.RefreshToken
+	if err := r.db.Where("token_hash = ?", hash).First(&t).Error; err != nil {
+		return nil, err
+	}
+	if r.revocations != nil && r.revocations.UserRevokedSince(t.UserID, t.CreatedAt) {
+		// another instance revoked everything; the row may lag on a replica
+		t.Revoked = true
+	}
+	return &t, nil
 }
 
 func (r *Repository) RevokeAllForUser(userID uint) error {
-    if err := r.db.Model(&models.RefreshToken{}).Where("user_id = ?", userID).Update("revoked", true).Error; err != nil {
-        return err
-    }
-    // optionally publish a pattern key for all tokens for the user
-    if r.cache != nil {
-        ctx := context.Background()
-        _ = r.cache.Publish(ctx, "revoked_refresh_user", fmt.Sprintf("user:%d", userID)).Err()
-    }
-    return nil
+	if err := r.db.Model(&models.RefreshToken{}).Where("user_id = ?", userID).Update("revoked", true).Error; err != nil {
+		return err
+	}
+	now := time.Now()
+	if r.revocations != nil {
+		r.revocations.AddUser(userID, now)
+	}
+	// optionally publish a pattern key for all tokens for the user
+	if r.cache != nil {
+		ctx := context.Background()
+		_ = r.cache.Publish(ctx, ChannelRevokedRefreshUser, fmt.Sprintf("user:%d:%d", userID, now.UnixNano())).Err()
+	}
+	return nil
+}
+
+// ErrTokenReused is returned by Rotate when the presented refresh token was
+// already revoked, i.e. it is being replayed.
+var ErrTokenReused = errors.New("refresh token reused")
+
+// FindRotatedByHash looks up a token that was already rotated, bypassing the
+// redis blacklist, so replays can be traced back to their family. Tokens
+// revoked by logout are not returned: presenting those is not suspicious.
+func (r *Repository) FindRotatedByHash(hash string) (*models.RefreshToken, error) {
+	var t models.RefreshToken
+	if err := r.db.Where("token_hash = ? AND rotated = ?", hash, true).First(&t).Error; err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// Rotate revokes the token identified by oldHash and stores next in its place.
+// The revoke is conditional, so if two requests race with the same token only
+// one wins and the other gets ErrTokenReused.
+func (r *Repository) Rotate(oldHash string, next *models.RefreshToken) error {
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		res := tx.Model(&models.RefreshToken{}).Where("token_hash = ? AND revoked = ?", oldHash, false).
+			Updates(map[string]interface{}{"revoked": true, "rotated": true, "rotated_at": time.Now()})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrTokenReused
+		}
+		return tx.Create(next).Error
+	})
+	if err != nil {
+		return err
+	}
+	r.markRevoked(oldHash)
+	return nil
+}
+
+// RevokeFamily revokes every live token descending from the same login.
+func (r *Repository) RevokeFamily(familyID string) error {
+	if familyID == "" {
+		return nil
+	}
+	var hashes []string
+	if err := r.db.Model(&models.RefreshToken{}).Where("family_id = ? AND revoked = ?", familyID, false).Pluck("token_hash", &hashes).Error; err != nil {
+		return err
+	}
+	if err := r.db.Model(&models.RefreshToken{}).Where("family_id = ?", familyID).Update("revoked", true).Error; err != nil {
+		return err
+	}
+	for _, h := range hashes {
+		r.markRevoked(h)
+	}
+	return nil
+}
+
+// ListActiveSessions returns the live refresh token of every session (token
+// family) of the user, most recently used first.
+func (r *Repository) ListActiveSessions(userID uint) ([]models.RefreshToken, error) {
+	var out []models.RefreshToken
+	err := r.db.Where("user_id = ? AND revoked = ? AND expires_at > ?", userID, false, time.Now()).
+		Order("last_used_at desc").Find(&out).Error
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// RevokeSession revokes one session of the user. It reports false when the
+// session does not exist, is already revoked or belongs to someone else.
+func (r *Repository) RevokeSession(userID uint, familyID string) (bool, error) {
+	var n int64
+	if err := r.db.Model(&models.RefreshToken{}).Where("user_id = ? AND family_id = ? AND revoked = ?", userID, familyID, false).Count(&n).Error; err != nil {
+		return false, err
+	}
+	if n == 0 {
+		return false, nil
+	}
+	return true, r.RevokeFamily(familyID)
 }
@@ -0,0 +1,160 @@
+package token
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Redis channels used to announce refresh-token revocations.
+const (
+	ChannelRevokedRefresh     = "revoked_refresh"
+	ChannelRevokedRefreshUser = "revoked_refresh_user"
+)
+
+// Revoked refresh-token hashes are also kept in Redis under
+// revokedRefreshPrefix for revokedRefreshTTL, for instances whose cache is not
+// synced.
+const (
+	revokedRefreshPrefix = "revoked_rt:"
+	revokedRefreshTTL    = 30 * 24 * time.Hour
+)
+
+// revocationRetention bounds how long a revoked hash is remembered locally.
+// The database stays authoritative; the cache only saves lookups.
+const revocationRetention = 24 * time.Hour
+
+// RevocationCache is an in-memory view of revoked refresh tokens, kept warm by
+// a Subscriber listening on the revoked_refresh channels.
+type RevocationCache struct {
+	sub    *Subscriber
+	warmed atomic.Bool
+
+	mu     sync.RWMutex
+	hashes map[string]time.Time // token hash -> when it was revoked
+	users  map[uint]time.Time   // user -> every token created before is revoked
+	pruned time.Time
+}
+
+func NewRevocationCache() *RevocationCache {
+	return &RevocationCache{hashes: map[string]time.Time{}, users: map[uint]time.Time{}}
+}
+
+// Attach subscribes the cache to the revocation channels and reloads it from
+// Redis on every (re)connect.
+func (rc *RevocationCache) Attach(sub *Subscriber) {
+	rc.sub = sub
+	sub.Handle(ChannelRevokedRefresh, func(payload string) { rc.AddHash(payload) })
+	sub.Handle(ChannelRevokedRefreshUser, rc.handleUser)
+	sub.OnConnect(rc.warm)
+}
+
+// Synced reports whether the cache is receiving every revocation, in which
+// case a miss can be trusted without asking Redis. It stays false until the
+// cache has been loaded, and while the subscriber is reconnecting.
+func (rc *RevocationCache) Synced() bool {
+	return rc.warmed.Load() && rc.sub.Healthy()
+}
+
+// warm loads the hashes revoked within revocationRetention from Redis,
+// covering whatever was published while this instance was not subscribed.
+func (rc *RevocationCache) warm(ctx context.Context) error {
+	iter := rc.sub.client.Scan(ctx, 0, revokedRefreshPrefix+"*", 500).Iterator()
+	for iter.Next(ctx) {
+		key := iter.Val()
+		ttl, err := rc.sub.client.PTTL(ctx, key).Result()
+		if err != nil {
+			return err
+		}
+		// the key was set with revokedRefreshTTL, so its age is what is gone
+		revokedAt := time.Now().Add(ttl - revokedRefreshTTL)
+		if ttl <= 0 || time.Since(revokedAt) > revocationRetention {
+			continue
+		}
+		rc.addHash(strings.TrimPrefix(key, revokedRefreshPrefix), revokedAt)
+	}
+	if err := iter.Err(); err != nil {
+		return err
+	}
+	rc.warmed.Store(true)
+	return nil
+}
+
+func (rc *RevocationCache) AddHash(hash string) {
+	rc.addHash(hash, time.Now())
+}
+
+func (rc *RevocationCache) addHash(hash string, at time.Time) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	if at.After(rc.hashes[hash]) {
+		rc.hashes[hash] = at
+	}
+	rc.pruneLocked()
+}
+
+func (rc *RevocationCache) AddUser(userID uint, at time.Time) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	if at.After(rc.users[userID]) {
+		rc.users[userID] = at
+	}
+	rc.pruneLocked()
+}
+
+// HashRevoked reports whether the token hash is known to be revoked.
+func (rc *RevocationCache) HashRevoked(hash string) bool {
+	rc.mu.RLock()
+	defer rc.mu.RUnlock()
+	_, ok := rc.hashes[hash]
+	return ok
+}
+
+// UserRevokedSince reports whether all of the user's tokens created at or
+// before createdAt were revoked.
+func (rc *RevocationCache) UserRevokedSince(userID uint, createdAt time.Time) bool {
+	rc.mu.RLock()
+	defer rc.mu.RUnlock()
+	at, ok := rc.users[userID]
+	return ok && !createdAt.After(at)
+}
+
+// handleUser parses "user:<id>:<unix-nanos>" (or the older "user:<id>").
+func (rc *RevocationCache) handleUser(payload string) {
+	parts := strings.Split(payload, ":")
+	if len(parts) < 2 || parts[0] != "user" {
+		return
+	}
+	id, err := strconv.ParseUint(parts[1], 10, 64)
+	if err != nil {
+		return
+	}
+	at := time.Now()
+	if len(parts) > 2 {
+		if ns, err := strconv.ParseInt(parts[2], 10, 64); err == nil {
+			at = time.Unix(0, ns)
+		}
+	}
+	rc.AddUser(uint(id), at)
+}
+
+func (rc *RevocationCache) pruneLocked() {
+	now := time.Now()
+	if now.Sub(rc.pruned) < time.Minute {
+		return
+	}
+	rc.pruned = now
+	for k, at := range rc.hashes {
+		if now.Sub(at) > revocationRetention {
+			delete(rc.hashes, k)
+		}
+	}
+	for k, at := range rc.users {
+		if now.Sub(at) > revocationRetention {
+			delete(rc.users, k)
+		}
+	}
+}
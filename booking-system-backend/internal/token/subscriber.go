@@ -0,0 +1,119 @@
+package token
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net"
+	"sync/atomic"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	subscriberPingEvery  = 30 * time.Second
+	subscriberMaxBackoff = 30 * time.Second
+)
+
+// Subscriber consumes revocation notifications published by other instances.
+// It reconnects with backoff whenever the connection drops and reports itself
+// healthy only while subscribed and warmed up, so callers know when their
+// in-memory view can be trusted instead of asking Redis.
+type Subscriber struct {
+	client    *redis.Client
+	handlers  map[string]func(payload string)
+	onConnect []func(ctx context.Context) error
+	healthy   atomic.Bool
+}
+
+func NewSubscriber(client *redis.Client) *Subscriber {
+	return &Subscriber{client: client, handlers: map[string]func(string){}}
+}
+
+// Handle registers fn for messages on channel. Call before Run.
+func (s *Subscriber) Handle(channel string, fn func(payload string)) {
+	s.handlers[channel] = fn
+}
+
+// OnConnect registers a hook run after every (re)subscription, before the
+// subscriber reports healthy. Use it to reload state missed while offline.
+func (s *Subscriber) OnConnect(fn func(ctx context.Context) error) {
+	s.onConnect = append(s.onConnect, fn)
+}
+
+// Healthy reports whether every message published since the last warm-up has
+// been delivered.
+func (s *Subscriber) Healthy() bool {
+	return s != nil && s.healthy.Load()
+}
+
+// Run consumes messages until ctx is cancelled.
+func (s *Subscriber) Run(ctx context.Context) {
+	backoff := time.Second
+	for {
+		connected, err := s.session(ctx)
+		s.healthy.Store(false)
+		if ctx.Err() != nil {
+			return
+		}
+		if connected {
+			backoff = time.Second
+		}
+		log.Printf("revocation subscriber: %v; reconnecting in %s", err, backoff)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		if backoff *= 2; backoff > subscriberMaxBackoff {
+			backoff = subscriberMaxBackoff
+		}
+	}
+}
+
+// session runs one subscription until it fails. connected reports whether it
+// got as far as being healthy, which resets the reconnect backoff.
+func (s *Subscriber) session(ctx context.Context) (connected bool, err error) {
+	channels := make([]string, 0, len(s.handlers))
+	for ch := range s.handlers {
+		channels = append(channels, ch)
+	}
+	ps := s.client.Subscribe(ctx, channels...)
+	defer ps.Close()
+	// a blocked receive does not watch ctx; closing the connection unblocks it
+	stop := context.AfterFunc(ctx, func() { _ = ps.Close() })
+	defer stop()
+
+	// wait for the subscription to be confirmed before warming up, so nothing
+	// published in between is lost
+	if _, err := ps.Receive(ctx); err != nil {
+		return false, err
+	}
+	for _, fn := range s.onConnect {
+		if err := fn(ctx); err != nil {
+			return false, err
+		}
+	}
+	s.healthy.Store(true)
+
+	for {
+		msg, err := ps.ReceiveTimeout(ctx, subscriberPingEvery)
+		if err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() && ctx.Err() == nil {
+				// idle: make sure the connection is still alive
+				if err := ps.Ping(ctx); err != nil {
+					return true, err
+				}
+				continue
+			}
+			return true, err
+		}
+		if m, ok := msg.(*redis.Message); ok {
+			if fn := s.handlers[m.Channel]; fn != nil {
+				fn(m.Payload)
+			}
+		}
+	}
+}
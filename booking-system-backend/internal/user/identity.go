@@ -0,0 +1,69 @@
+package user
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/temu-in/temu.in/booking-system-backend/internal/models"
+)
+
+// FindIdentity returns the link for a provider account, or nil if there is
+// none.
+func (r *Repository) FindIdentity(provider, subject string) (*models.Identity, error) {
+	var id models.Identity
+	if err := r.db.Where("provider = ? AND subject = ?", provider, subject).First(&id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &id, nil
+}
+
+func (r *Repository) CreateIdentity(id *models.Identity) error {
+	return r.db.Create(id).Error
+}
+
+// CreateWithIdentity creates a user together with its first identity.
+func (r *Repository) CreateWithIdentity(u *models.User, id *models.Identity) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(u).Error; err != nil {
+			return err
+		}
+		id.UserID = u.ID
+		return tx.Create(id).Error
+	})
+}
+
+// TouchIdentity records a login through the identity.
+func (r *Repository) TouchIdentity(id uint, email string) error {
+	return r.db.Model(&models.Identity{}).Where("id = ?", id).Updates(map[string]interface{}{"email": email, "last_login_at": time.Now()}).Error
+}
+
+func (r *Repository) ListIdentities(userID uint) ([]models.Identity, error) {
+	var out []models.Identity
+	if err := r.db.Where("user_id = ?", userID).Order("created_at").Find(&out).Error; err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// DeleteIdentity unlinks one identity of the user. It reports false when it
+// does not exist or belongs to someone else.
+func (r *Repository) DeleteIdentity(userID, id uint) (bool, error) {
+	res := r.db.Where("id = ? AND user_id = ?", id, userID).Delete(&models.Identity{})
+	if res.Error != nil {
+		return false, res.Error
+	}
+	return res.RowsAffected > 0, nil
+}
+
+// ClaimUnverified marks an unverified account verified on behalf of an
+// external provider that vouched for the address, and clears the password
+// whoever registered the account set, so only the address owner keeps access.
+// Bumps the security version.
+func (r *Repository) ClaimUnverified(id uint) error {
+	return r.updateSecurity(id, map[string]interface{}{"is_verified": true, "verified_at": time.Now(), "password": ""})
+}
@@ -0,0 +1,53 @@
+package user
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/temu-in/temu.in/booking-system-backend/internal/models"
+)
+
+func (r *Repository) CreatePasskey(p *models.Passkey) error {
+	return r.db.Create(p).Error
+}
+
+// ListPasskeys returns the user's passkeys, oldest first.
+func (r *Repository) ListPasskeys(userID uint) ([]models.Passkey, error) {
+	var out []models.Passkey
+	if err := r.db.Where("user_id = ?", userID).Order("created_at").Find(&out).Error; err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// FindPasskeyByCredentialID returns the passkey with the given WebAuthn
+// credential ID, or nil if there is none.
+func (r *Repository) FindPasskeyByCredentialID(credentialID []byte) (*models.Passkey, error) {
+	var p models.Passkey
+	if err := r.db.Where("credential_id = ?", credentialID).First(&p).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &p, nil
+}
+
+// UpdatePasskeyUse stores the authenticator state reported by a login.
+func (r *Repository) UpdatePasskeyUse(id uint, signCount uint32, cloneWarning, backupState bool) error {
+	return r.db.Model(&models.Passkey{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"sign_count": signCount, "clone_warning": cloneWarning, "backup_state": backupState, "last_used_at": time.Now(),
+	}).Error
+}
+
+// DeletePasskey removes one passkey of the user. It reports false when the
+// passkey does not exist or belongs to someone else.
+func (r *Repository) DeletePasskey(userID, id uint) (bool, error) {
+	res := r.db.Where("id = ? AND user_id = ?", id, userID).Delete(&models.Passkey{})
+	if res.Error != nil {
+		return false, res.Error
+	}
+	return res.RowsAffected > 0, nil
+}
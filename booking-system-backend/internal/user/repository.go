@@ -1,51 +1,373 @@
 package user
 
 import (
-    "errors"
+	"errors"
+	"time"
 
-    "gorm.io/gorm"
-    "github.com/temu-in/temu.in/booking-system-backend/internal/models"
+	"github.com/temu-in/temu.in/booking-system-backend/internal/models"
+	"github.com/temu-in/temu.in/booking-system-backend/internal/pagination"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
+// ErrLastAdmin is returned when a change would leave no admin account.
+var ErrLastAdmin = errors.New("cannot remove the last admin")
+
 type Repository struct {
-    db *gorm.DB
+	db        *gorm.DB
+	onVersion func(userID, version uint)
 }
 
 func NewRepository(db *gorm.DB) *Repository {
-    return &Repository{db: db}
+	return &Repository{db: db}
 }
 
 func (r *Repository) Create(u *models.User) error {
-    return r.db.Create(u).Error
+	return r.db.Create(u).Error
 }
 
 func (r *Repository) FindByEmail(email string) (*models.User, error) {
-    var u models.User
-    if err := r.db.Where("email = ?", email).First(&u).Error; err != nil {
-        if errors.Is(err, gorm.ErrRecordNotFound) {
-            return nil, nil
-        }
-        return nil, err
-    }
-    return &u, nil
+	var u models.User
+	if err := r.db.Where("email = ?", email).First(&u).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &u, nil
 }
 
 func (r *Repository) FindByID(id uint) (*models.User, error) {
-    var u models.User
-    if err := r.db.First(&u, id).Error; err != nil {
-        return nil, err
-    }
-    return &u, nil
+	var u models.User
+	if err := r.db.First(&u, id).Error; err != nil {
+		return nil, err
+	}
+	return &u, nil
+}
+
+// OnSecurityVersionChange registers fn to be told about every security
+// version bump, e.g. to refresh caches on other instances.
+func (r *Repository) OnSecurityVersionChange(fn func(userID, version uint)) {
+	r.onVersion = fn
+}
+
+// SetRole changes the role and bumps the security version, so tokens issued
+// with the old role stop working.
+func (r *Repository) SetRole(id uint, role models.Role) error {
+	return r.updateSecurity(id, map[string]interface{}{"role": role})
+}
+
+// ChangeRole sets a user's role and returns the previous one. It refuses to
+// demote the last admin.
+func (r *Repository) ChangeRole(id uint, role models.Role) (models.Role, error) {
+	var old models.Role
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		u, err := lockUserGuarded(tx, id)
+		if err != nil {
+			return err
+		}
+		old = u.Role
+		if old == role {
+			return nil
+		}
+		if role != models.RoleAdmin {
+			if err := keepAnAdmin(tx, u); err != nil {
+				return err
+			}
+		}
+		return tx.Model(&models.User{}).Where("id = ?", id).Updates(map[string]interface{}{"role": role, "security_version": gorm.Expr("security_version + 1")}).Error
+	})
+	if err != nil || old == role {
+		return old, err
+	}
+	return old, r.notifyVersion(id)
+}
+
+// Suspend blocks the user from logging in until until, or until Unsuspend
+// when until is nil. Like a demotion it cannot take out the last admin.
+func (r *Repository) Suspend(id uint, reason string, until *time.Time) error {
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		u, err := lockUserGuarded(tx, id)
+		if err != nil {
+			return err
+		}
+		if err := keepAnAdmin(tx, u); err != nil {
+			return err
+		}
+		return tx.Model(&models.User{}).Where("id = ?", id).Updates(map[string]interface{}{
+			"suspended_at": time.Now(), "suspended_until": until, "suspend_reason": reason,
+			"security_version": gorm.Expr("security_version + 1"),
+		}).Error
+	})
+	if err != nil {
+		return err
+	}
+	return r.notifyVersion(id)
+}
+
+// Unsuspend lifts a suspension.
+func (r *Repository) Unsuspend(id uint) error {
+	return r.updateSecurity(id, map[string]interface{}{"suspended_at": nil, "suspended_until": nil, "suspend_reason": ""})
+}
+
+// SoftDelete marks the user deleted; it no longer shows up in lookups and
+// cannot log in, but Restore can bring it back. It cannot take out the last
+// admin.
+func (r *Repository) SoftDelete(id uint) error {
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		u, err := lockUserGuarded(tx, id)
+		if err != nil {
+			return err
+		}
+		if err := keepAnAdmin(tx, u); err != nil {
+			return err
+		}
+		if err := tx.Model(&models.User{}).Where("id = ?", id).Update("security_version", gorm.Expr("security_version + 1")).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&models.User{}, id).Error
+	})
+	if err != nil {
+		return err
+	}
+	return r.notifyVersion(id)
+}
+
+// FindDeletedByID returns a soft-deleted user, or nil if there is no deleted
+// user with that id.
+func (r *Repository) FindDeletedByID(id uint) (*models.User, error) {
+	var u models.User
+	if err := r.db.Unscoped().Where("deleted_at IS NOT NULL").First(&u, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &u, nil
+}
+
+// Restore undoes SoftDelete.
+func (r *Repository) Restore(id uint) error {
+	if err := r.db.Unscoped().Model(&models.User{}).Where("id = ?", id).Updates(map[string]interface{}{"deleted_at": nil, "security_version": gorm.Expr("security_version + 1")}).Error; err != nil {
+		return err
+	}
+	return r.notifyVersion(id)
+}
+
+// lockUserGuarded locks the admin rows and then the user for the rest of
+// the transaction, so concurrent changes cannot each leave the other as the
+// last admin and both go through.
+func lockUserGuarded(tx *gorm.DB, id uint) (*models.User, error) {
+	var admins []uint
+	if err := tx.Model(&models.User{}).Clauses(clause.Locking{Strength: "UPDATE"}).Where("role = ?", models.RoleAdmin).Pluck("id", &admins).Error; err != nil {
+		return nil, err
+	}
+	var u models.User
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&u, id).Error; err != nil {
+		return nil, err
+	}
+	return &u, nil
+}
+
+// keepAnAdmin returns ErrLastAdmin if u is the only admin able to log in.
+func keepAnAdmin(tx *gorm.DB, u *models.User) error {
+	if u.Role != models.RoleAdmin || u.Suspended(time.Now()) {
+		return nil
+	}
+	var others int64
+	err := tx.Model(&models.User{}).
+		Where("role = ? AND id <> ?", models.RoleAdmin, u.ID).
+		Where("suspended_at IS NULL OR suspended_until <= ?", time.Now()).
+		Count(&others).Error
+	if err != nil {
+		return err
+	}
+	if others == 0 {
+		return ErrLastAdmin
+	}
+	return nil
+}
+
+// DisabledVersion is what SecurityVersion reports for suspended and deleted
+// users. No token carries it, so all of theirs count as stale.
+const DisabledVersion = ^uint(0)
+
+// SecurityVersion returns the user's current security version, or
+// DisabledVersion if the user is suspended or deleted.
+func (r *Repository) SecurityVersion(id uint) (uint, error) {
+	var u models.User
+	err := r.db.Unscoped().Select("id, security_version, deleted_at, suspended_at, suspended_until").First(&u, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return DisabledVersion, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	if u.DeletedAt.Valid || u.Suspended(time.Now()) {
+		return DisabledVersion, nil
+	}
+	return u.SecurityVersion, nil
+}
+
+// BumpSecurityVersion invalidates every access token issued to the user.
+func (r *Repository) BumpSecurityVersion(id uint) error {
+	return r.updateSecurity(id, map[string]interface{}{})
+}
+
+// updateSecurity applies fields together with a security version bump and
+// notifies the registered hook.
+func (r *Repository) updateSecurity(id uint, fields map[string]interface{}) error {
+	fields["security_version"] = gorm.Expr("security_version + 1")
+	if err := r.db.Model(&models.User{}).Where("id = ?", id).Updates(fields).Error; err != nil {
+		return err
+	}
+	return r.notifyVersion(id)
+}
+
+// notifyVersion passes the user's current security version to the registered
+// hook.
+func (r *Repository) notifyVersion(id uint) error {
+	if r.onVersion == nil {
+		return nil
+	}
+	v, err := r.SecurityVersion(id)
+	if err != nil {
+		return err
+	}
+	r.onVersion(id, v)
+	return nil
+}
+
+// ListFilter narrows List. Zero values match everything.
+type ListFilter struct {
+	Role          models.Role
+	Verified      *bool
+	CreatedAfter  time.Time
+	CreatedBefore time.Time
+	// Query matches a substring of the email or name, case-insensitively.
+	Query string
+}
+
+// UserSorts are the sort keys List accepts.
+var UserSorts = pagination.Sorts{"created_at": "created_at", "email": "email", "name": "name", "role": "role"}
+
+// List returns one page of the users matching f and the total number of
+// matches.
+func (r *Repository) List(f ListFilter, p pagination.Params) ([]models.User, int64, error) {
+	q := r.db.Model(&models.User{})
+	if f.Role != "" {
+		q = q.Where("role = ?", f.Role)
+	}
+	if f.Verified != nil {
+		q = q.Where("is_verified = ?", *f.Verified)
+	}
+	if !f.CreatedAfter.IsZero() {
+		q = q.Where("created_at >= ?", f.CreatedAfter)
+	}
+	if !f.CreatedBefore.IsZero() {
+		q = q.Where("created_at < ?", f.CreatedBefore)
+	}
+	if f.Query != "" {
+		like := "%" + pagination.EscapeLike(f.Query) + "%"
+		q = q.Where("email ILIKE ? OR name ILIKE ?", like, like)
+	}
+
+	// Count leaves its select on the statement; give each query its own
+	q = q.Session(&gorm.Session{})
+	var total int64
+	if err := q.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var users []models.User
+	if err := p.Apply(q).Find(&users).Error; err != nil {
+		return nil, 0, err
+	}
+	return users, total, nil
+}
+
+// UpdatePassword sets a new password and bumps the security version.
+func (r *Repository) UpdatePassword(id uint, hash string) error {
+	return r.updateSecurity(id, map[string]interface{}{"password": hash})
+}
+
+// RehashPassword stores a new hash of the same password. Unlike
+// UpdatePassword it leaves existing tokens alone.
+func (r *Repository) RehashPassword(id uint, hash string) error {
+	return r.db.Model(&models.User{}).Where("id = ?", id).Update("password", hash).Error
+}
+
+func (r *Repository) MarkVerified(id uint) error {
+	return r.db.Model(&models.User{}).Where("id = ?", id).Updates(map[string]interface{}{"is_verified": true, "verified_at": time.Now()}).Error
+}
+
+// SetTOTPSecret stores a pending secret during enrollment; it is not enforced
+// until EnableTOTP is called.
+func (r *Repository) SetTOTPSecret(id uint, secret string) error {
+	return r.db.Model(&models.User{}).Where("id = ?", id).Updates(map[string]interface{}{"totp_secret": secret, "totp_enabled": false}).Error
+}
+
+func (r *Repository) EnableTOTP(id uint) error {
+	return r.db.Model(&models.User{}).Where("id = ?", id).Update("totp_enabled", true).Error
+}
+
+func (r *Repository) DisableTOTP(id uint) error {
+	return r.db.Model(&models.User{}).Where("id = ?", id).Updates(map[string]interface{}{"totp_secret": "", "totp_enabled": false, "totp_last_step": 0}).Error
+}
+
+// UseTOTPStep records the time step of an accepted code. It reports false if
+// that step (or a later one) was already used, i.e. the code is a replay.
+func (r *Repository) UseTOTPStep(id uint, step int64) (bool, error) {
+	res := r.db.Model(&models.User{}).Where("id = ? AND totp_last_step < ?", id, step).Update("totp_last_step", step)
+	if res.Error != nil {
+		return false, res.Error
+	}
+	return res.RowsAffected == 1, nil
+}
+
+// MigrateVerification adds the email verification columns to an existing
+// users table and marks every account already in it as verified: they were
+// created before addresses were checked, and UNVERIFIED_POLICY=login would
+// otherwise lock them all out. It runs before AutoMigrate and does nothing
+// once the columns exist, so accounts registered later keep their state.
+func MigrateVerification(db *gorm.DB) error {
+	m := db.Migrator()
+	if !m.HasTable(&models.User{}) || m.HasColumn(&models.User{}, "IsVerified") {
+		return nil
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		for _, field := range []string{"IsVerified", "VerifiedAt"} {
+			if tx.Migrator().HasColumn(&models.User{}, field) {
+				continue
+			}
+			if err := tx.Migrator().AddColumn(&models.User{}, field); err != nil {
+				return err
+			}
+		}
+		return tx.Model(&models.User{}).Unscoped().Where("is_verified = ?", false).
+			Updates(map[string]interface{}{"is_verified": true, "verified_at": gorm.Expr("created_at")}).Error
+	})
 }
 
-func (r *Repository) SetRole(id uint, role string) error {
-    return r.db.Model(&models.User{}).Where("id = ?", id).Update("role", role).Error
+// MigrateRoles rewrites the pre-typed "user" role to models.RoleCustomer.
+// models.Role reads the old value correctly either way; this just keeps the
+// column consistent for queries.
+func MigrateRoles(db *gorm.DB) error {
+	return db.Model(&models.User{}).Where("role = ?", "user").Update("role", models.RoleCustomer).Error
 }
 
-func (r *Repository) ListAll() ([]models.User, error) {
-    var users []models.User
-    if err := r.db.Select("id, email, name, role").Find(&users).Error; err != nil {
-        return nil, err
-    }
-    return users, nil
+// MigrateSearchIndexes adds the trigram indexes behind List's substring
+// search. They need the pg_trgm extension; without it search still works,
+// only slower.
+func MigrateSearchIndexes(db *gorm.DB) error {
+	stmts := []string{
+		"CREATE EXTENSION IF NOT EXISTS pg_trgm",
+		"CREATE INDEX IF NOT EXISTS idx_users_email_trgm ON users USING gin (email gin_trgm_ops)",
+		"CREATE INDEX IF NOT EXISTS idx_users_name_trgm ON users USING gin (name gin_trgm_ops)",
+	}
+	for _, stmt := range stmts {
+		if err := db.Exec(stmt).Error; err != nil {
+			return err
+		}
+	}
+	return nil
 }